@@ -0,0 +1,462 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/time/rate"
+
+	"github.com/ghchinoy/gen/internal/model"
+)
+
+var (
+	batchInput   string
+	batchOutput  string
+	batchWorkers int
+	batchRPM     float64
+	batchRetries int
+)
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+
+	batchCmd.Flags().StringVarP(&modelName, "model", "m", defaultModelName, "model name or alias, defaults to the defaultModel of gen.yaml")
+	batchCmd.Flags().StringVarP(&modelConfigFile, "config", "c", "", "model parameters")
+	batchCmd.Flags().StringVarP(&systemInstructions, "system", "s", "", "system instructions for every prompt without its own")
+	batchCmd.Flags().StringVar(&systemFile, "system-file", "", "system instructions from file")
+	batchCmd.Flags().StringVarP(&batchInput, "input", "i", "", "prompts file, JSON lines or CSV, or - for stdin (default is stdin when piped)")
+	// --output is the results file, shadowing the output type, as the results are always JSON lines
+	batchCmd.Flags().StringVarP(&batchOutput, "output", "o", "", "results file, JSON lines (default is stdout)")
+	batchCmd.Flags().IntVarP(&batchWorkers, "workers", "w", 4, "number of prompts to run at once")
+	batchCmd.Flags().Float64Var(&batchRPM, "rpm", 0, "maximum requests per minute, 0 for no limit")
+	batchCmd.Flags().IntVar(&batchRetries, "retries", 3, "number of retries for rate limited or unavailable requests")
+	batchCmd.Flags().BoolVar(&showUsage, "usage", false, "print the total token usage and estimated cost")
+}
+
+var batchCmd = &cobra.Command{
+	Use:   "batch",
+	Short: "Run a file of prompts through a model",
+	Long: `Runs every prompt in an input file through one model, several at a time, and writes a result per prompt as JSON lines.
+
+The input is JSON lines, one {"id": "...", "prompt": "...", "system": "..."} object per line,
+or CSV with a header row naming the prompt, id and system columns. The id and system are optional;
+prompts without an id are identified by their line number.
+
+Prompts can be piped to stdin instead of given with --input. Prompts larger than the model's
+context window fail without being sent.
+
+Results are written in input order. Rate limited and unavailable requests are retried with backoff,
+and rerunning with the same output file skips the prompts that already have a result.`,
+	Example: `  gen batch -i prompts.jsonl -o results.jsonl
+  gen batch -m claude-3-5-sonnet@20240620 -i prompts.csv -o results.jsonl --workers 8 --rpm 60
+  jq -c '{prompt: .text}' reviews.jsonl | gen batch -o results.jsonl`,
+	Args: cobra.NoArgs,
+	RunE: batchE,
+}
+
+// batchItem is a prompt in a batch input file.
+type batchItem struct {
+	ID     string `json:"id"`
+	Prompt string `json:"prompt"`
+	System string `json:"system,omitempty"`
+}
+
+// UnmarshalJSON accepts a numeric or string id.
+func (b *batchItem) UnmarshalJSON(data []byte) error {
+	var item struct {
+		ID     json.RawMessage `json:"id"`
+		Prompt string          `json:"prompt"`
+		System string          `json:"system"`
+	}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return err
+	}
+	b.Prompt, b.System = item.Prompt, item.System
+	b.ID = ""
+	if len(item.ID) > 0 && string(item.ID) != "null" {
+		if err := json.Unmarshal(item.ID, &b.ID); err != nil {
+			b.ID = string(item.ID)
+		}
+	}
+	return nil
+}
+
+// batchResult is the result of a prompt in a batch output file.
+type batchResult struct {
+	ID        string       `json:"id"`
+	Prompt    string       `json:"prompt"`
+	Response  string       `json:"response"`
+	Usage     *model.Usage `json:"usage,omitempty"`
+	LatencyMs int64        `json:"latencyMs,omitempty"`
+	Attempts  int          `json:"attempts,omitempty"`
+	Error     string       `json:"error,omitempty"`
+}
+
+// indexedResult is a result and the position of its prompt in the batch.
+type indexedResult struct {
+	index  int
+	result batchResult
+}
+
+// batchE runs the prompts of the input file that don't yet have a result in the output file.
+func batchE(cmd *cobra.Command, args []string) error {
+	if batchWorkers < 1 {
+		return fmt.Errorf("--workers must be at least 1")
+	}
+	if err := selectModel(cmd); err != nil {
+		return err
+	}
+
+	if batchInput == "" {
+		if !stdinPiped() {
+			return fmt.Errorf("provide a prompts file with --input, or pipe prompts to stdin")
+		}
+		batchInput = "-"
+	}
+	items, err := readBatchInput(batchInput)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := newConfig()
+	if err != nil {
+		return err
+	}
+	// responses are collected from the conversation, not the streamed output
+	cfg.OutputType = "text"
+
+	system, err := readSystemInstructions()
+	if err != nil {
+		return err
+	}
+	defaults := &model.Conversation{System: system}
+	if err := applyModelDefaults(&cfg, modelName, defaults); err != nil {
+		return err
+	}
+	system = defaults.System
+
+	var w io.Writer = os.Stdout
+	var done map[string]bool
+	if batchOutput != "" {
+		f, completed, err := openBatchOutput(batchOutput)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+		done = completed
+	}
+
+	var pending []batchItem
+	for _, item := range items {
+		if !done[item.ID] {
+			pending = append(pending, item)
+		}
+	}
+	if skipped := len(items) - len(pending); skipped > 0 {
+		fmt.Fprintf(os.Stderr, "skipping %d prompts with results in %s\n", skipped, batchOutput)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	// stop starting new prompts on interrupt, keeping the results written so far
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client, err := model.NewClient(ctx, cfg, modelName)
+	if err != nil {
+		return fmt.Errorf("error creating client: %w", err)
+	}
+	defer client.Close()
+
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if batchRPM > 0 {
+		limiter = rate.NewLimiter(rate.Limit(batchRPM/60), 1)
+	}
+
+	jobs := make(chan int)
+	results := make(chan indexedResult)
+	var wg sync.WaitGroup
+	for range min(batchWorkers, len(pending)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				item := pending[i]
+				if item.System == "" {
+					item.System = system
+				}
+				conv := model.NewConversation(item.Prompt)
+				conv.System = item.System
+				if err := checkContextWindow(modelName, conv); err != nil {
+					results <- indexedResult{i, batchResult{ID: item.ID, Prompt: item.Prompt, Error: err.Error()}}
+					continue
+				}
+				results <- indexedResult{i, runBatchItem(ctx, client, limiter, cfg.ModelParameters, item)}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range pending {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// results arrive in any order, and are written in input order
+	enc := json.NewEncoder(w)
+	waiting := map[int]batchResult{}
+	next, failed := 0, 0
+	var total model.Usage
+	for r := range results {
+		waiting[r.index] = r.result
+		for {
+			result, ok := waiting[next]
+			if !ok {
+				break
+			}
+			delete(waiting, next)
+			next++
+			if result.Error != "" {
+				failed++
+			}
+			if result.Usage != nil {
+				total = total.Add(*result.Usage)
+			}
+			if err := enc.Encode(result); err != nil {
+				return fmt.Errorf("error writing result: %w", err)
+			}
+			if Logtype != "none" {
+				fmt.Fprintf(os.Stderr, "%d/%d %s\n", next, len(pending), result.ID)
+			}
+		}
+	}
+
+	if showUsage {
+		printUsage(os.Stderr, "total", modelName, total)
+	}
+	if next < len(pending) {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("interrupted after %d of %d prompts", next, len(pending))
+	}
+	if failed > 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d of %d prompts failed", failed, len(pending))
+	}
+	return nil
+}
+
+// runBatchItem generates a response to a prompt, retrying transient errors with exponential backoff.
+func runBatchItem(ctx context.Context, client model.ModelClient, limiter *rate.Limiter, params model.GenerationParameters, item batchItem) batchResult {
+	result := batchResult{ID: item.ID, Prompt: item.Prompt}
+	backoff := time.Second
+	for {
+		result.Attempts++
+		if err := limiter.Wait(ctx); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+
+		conv := model.NewConversation(item.Prompt)
+		conv.System = item.System
+		start := time.Now()
+		err := client.GenerateChat(ctx, io.Discard, conv, params)
+		result.LatencyMs = time.Since(start).Milliseconds()
+		if err == nil {
+			result.Response = conv.Messages[len(conv.Messages)-1].Text
+			result.Usage = conv.LastUsage()
+			result.Error = ""
+			return result
+		}
+		result.Error = err.Error()
+		if result.Attempts > batchRetries || !model.IsTransient(err) {
+			return result
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return result
+		}
+		backoff = min(2*backoff, time.Minute)
+	}
+}
+
+// readBatchInput reads the prompts of a JSON lines or CSV file, or of stdin for -, checking their ids are unique.
+func readBatchInput(path string) ([]batchItem, error) {
+	var items []batchItem
+	if path == "-" {
+		input, err := readStdin()
+		if err != nil {
+			return nil, err
+		}
+		// JSON lines start with an object, anything else is read as CSV
+		path = "stdin"
+		if strings.HasPrefix(strings.TrimSpace(input), "{") {
+			items, err = readBatchJSONL(strings.NewReader(input))
+		} else {
+			items, err = readBatchCSV(strings.NewReader(input))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", path, err)
+		}
+		return checkBatchIDs(path, items)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		items, err = readBatchCSV(f)
+	} else {
+		items, err = readBatchJSONL(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return checkBatchIDs(path, items)
+}
+
+// checkBatchIDs returns the prompts read from path if their ids are unique.
+func checkBatchIDs(path string, items []batchItem) ([]batchItem, error) {
+	ids := map[string]bool{}
+	for _, item := range items {
+		if ids[item.ID] {
+			return nil, fmt.Errorf("error reading %s: duplicate id %s", path, item.ID)
+		}
+		ids[item.ID] = true
+	}
+	return items, nil
+}
+
+func readBatchJSONL(r io.Reader) ([]batchItem, error) {
+	var items []batchItem
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var item batchItem
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if item.Prompt == "" {
+			return nil, fmt.Errorf("line %d: missing prompt", line)
+		}
+		if item.ID == "" {
+			item.ID = strconv.Itoa(line)
+		}
+		items = append(items, item)
+	}
+	return items, scanner.Err()
+}
+
+func readBatchCSV(r io.Reader) ([]batchItem, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	promptColumn, ok := columns["prompt"]
+	if !ok {
+		return nil, fmt.Errorf("missing a prompt column in the header row")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	var items []batchItem
+	for n, record := range records[1:] {
+		// the line number, counting the header
+		line := n + 2
+		item := batchItem{
+			ID:     field(record, "id"),
+			Prompt: record[promptColumn],
+			System: field(record, "system"),
+		}
+		if item.Prompt == "" {
+			return nil, fmt.Errorf("line %d: missing prompt", line)
+		}
+		if item.ID == "" {
+			item.ID = strconv.Itoa(line)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// openBatchOutput opens a results file for appending, returning the ids that already have a successful result.
+// Failed results are dropped from the file, so they are retried.
+func openBatchOutput(path string) (*os.File, map[string]bool, error) {
+	done := map[string]bool{}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("unable to read file %s: %w", path, err)
+	}
+
+	var kept []byte
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var result batchResult
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			// an interrupted write leaves a partial last line
+			continue
+		}
+		if result.Error != "" || done[result.ID] {
+			continue
+		}
+		done[result.ID] = true
+		kept = append(kept, strings.TrimRight(line, "\n")...)
+		kept = append(kept, '\n')
+	}
+	if len(kept) != len(data) {
+		if err := os.WriteFile(path, kept, 0o644); err != nil {
+			return nil, nil, fmt.Errorf("unable to write file %s: %w", path, err)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open file %s: %w", path, err)
+	}
+	return f, done, nil
+}
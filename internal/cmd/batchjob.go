@@ -0,0 +1,447 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ghchinoy/gen/internal/gcs"
+	"github.com/ghchinoy/gen/internal/history"
+	"github.com/ghchinoy/gen/internal/model"
+)
+
+var (
+	batchGCS         string
+	batchDisplayName string
+	batchWait        bool
+	batchInterval    time.Duration
+	batchRaw         bool
+	batchJobsLimit   int
+)
+
+func init() {
+	batchCmd.AddCommand(batchSubmitCmd, batchStatusCmd, batchResultsCmd, batchCancelCmd)
+
+	batchSubmitCmd.Flags().StringVarP(&modelName, "model", "m", defaultModelName, "model name or alias, a Gemini or Claude model, defaults to the defaultModel of gen.yaml")
+	batchSubmitCmd.Flags().StringVarP(&modelConfigFile, "config", "c", "", "model parameters")
+	batchSubmitCmd.Flags().StringVarP(&systemInstructions, "system", "s", "", "system instructions for every prompt without its own")
+	batchSubmitCmd.Flags().StringVar(&systemFile, "system-file", "", "system instructions from file")
+	batchSubmitCmd.Flags().StringVarP(&batchInput, "input", "i", "", "prompts file, JSON lines or CSV")
+	batchSubmitCmd.Flags().StringVar(&batchGCS, "gcs", "", "Cloud Storage location for the job's input and output, gs://bucket/path")
+	batchSubmitCmd.Flags().StringVar(&batchDisplayName, "name", "", "job display name (default is gen-batch- and a timestamp)")
+	batchSubmitCmd.Flags().BoolVar(&batchWait, "wait", false, "wait for the job to finish")
+	batchSubmitCmd.Flags().DurationVar(&batchInterval, "interval", 30*time.Second, "how often to check the job's state when waiting")
+	batchSubmitCmd.MarkFlagRequired("input")
+	batchSubmitCmd.MarkFlagRequired("gcs")
+
+	batchStatusCmd.Flags().BoolVar(&batchWait, "wait", false, "wait for the job to finish")
+	batchStatusCmd.Flags().DurationVar(&batchInterval, "interval", 30*time.Second, "how often to check the job's state when waiting")
+	batchStatusCmd.Flags().IntVarP(&batchJobsLimit, "limit", "n", 20, "number of jobs to list, 0 for all")
+
+	batchResultsCmd.Flags().StringVarP(&batchOutput, "output", "o", "", "results file, JSON lines (default is stdout)")
+	batchResultsCmd.Flags().StringVarP(&batchInput, "input", "i", "", "the submitted prompts file, to match Gemini results to their ids")
+	batchResultsCmd.Flags().BoolVar(&batchRaw, "raw", false, "write the job's prediction lines as they are")
+}
+
+var batchSubmitCmd = &cobra.Command{
+	Use:   "submit",
+	Short: "Submit a file of prompts as a Vertex AI batch prediction job",
+	Long: `Converts a prompts file, in the same JSON lines or CSV format as gen batch, to batch prediction requests,
+uploads them to Cloud Storage under --gcs, and creates a Vertex AI batch prediction job writing its output there.
+Batch prediction jobs support Gemini and Claude models.`,
+	Example: `  gen batch submit -i prompts.jsonl --gcs gs://my-bucket/batches
+  gen batch submit -m claude-3-5-sonnet@20240620 -i prompts.csv --gcs gs://my-bucket/batches --wait`,
+	Args: cobra.NoArgs,
+	RunE: submitBatchJob,
+}
+
+var batchStatusCmd = &cobra.Command{
+	Use:   "status [job]",
+	Short: "Show a batch prediction job, or list recent jobs",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := newConfig()
+		if err != nil {
+			return err
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		client, err := model.NewBatchClient(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		if len(args) == 0 {
+			jobs, err := client.Jobs(ctx, batchJobsLimit)
+			if err != nil {
+				return err
+			}
+			return listBatchJobs(os.Stdout, jobs)
+		}
+
+		job, err := client.Job(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		if batchWait {
+			job, err = waitForBatchJob(ctx, client, job)
+			if err != nil {
+				return err
+			}
+		}
+		return showBatchJob(os.Stdout, job)
+	},
+}
+
+var batchResultsCmd = &cobra.Command{
+	Use:   "results <job>",
+	Short: "Download the results of a batch prediction job",
+	Long: `Downloads the predictions of a finished batch prediction job from Cloud Storage, and writes them
+as JSON lines in the same format as gen batch. Claude results keep their prompt ids; Gemini results are
+matched to their ids by their position in the submitted prompts file given with --input.`,
+	Args: cobra.ExactArgs(1),
+	RunE: downloadBatchResults,
+}
+
+var batchCancelCmd = &cobra.Command{
+	Use:   "cancel <job>",
+	Short: "Cancel a batch prediction job",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := newConfig()
+		if err != nil {
+			return err
+		}
+		ctx := context.Background()
+		client, err := model.NewBatchClient(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		if err := client.Cancel(ctx, args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("cancelling batch prediction job %s\n", args[0])
+		return nil
+	},
+}
+
+// submitBatchJob uploads the prompts as batch prediction requests and creates the job.
+func submitBatchJob(cmd *cobra.Command, args []string) error {
+	if err := selectModel(cmd); err != nil {
+		return err
+	}
+	items, err := readBatchInput(batchInput)
+	if err != nil {
+		return err
+	}
+	if _, _, err := gcs.ParseURI(batchGCS); err != nil {
+		return err
+	}
+
+	cfg, err := newConfig()
+	if err != nil {
+		return err
+	}
+	system, err := readSystemInstructions()
+	if err != nil {
+		return err
+	}
+	defaults := &model.Conversation{System: system}
+	if err := applyModelDefaults(&cfg, modelName, defaults); err != nil {
+		return err
+	}
+	system = defaults.System
+
+	var requests []byte
+	for i, item := range items {
+		conv := model.NewConversation(item.Prompt)
+		conv.System = item.System
+		if conv.System == "" {
+			conv.System = system
+		}
+		line, err := model.BatchRequest(modelName, item.ID, i+1, conv, cfg.ModelParameters)
+		if err != nil {
+			return err
+		}
+		requests = append(append(requests, line...), '\n')
+	}
+
+	if batchDisplayName == "" {
+		batchDisplayName = "gen-batch-" + strings.ToLower(history.NewID())
+	}
+	prefix := strings.TrimSuffix(batchGCS, "/") + "/" + batchDisplayName
+	inputURI := prefix + "/input.jsonl"
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	storage, err := gcs.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	if err := storage.Upload(ctx, inputURI, requests, "application/jsonl"); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "uploaded %d requests to %s\n", len(items), inputURI)
+
+	client, err := model.NewBatchClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	job, err := client.Submit(ctx, batchDisplayName, modelName, inputURI, prefix+"/output")
+	if err != nil {
+		return err
+	}
+	if batchWait {
+		job, err = waitForBatchJob(ctx, client, job)
+		if err != nil {
+			return err
+		}
+	}
+	return showBatchJob(os.Stdout, job)
+}
+
+// waitForBatchJob polls a job until it finishes, reporting state changes on stderr.
+func waitForBatchJob(ctx context.Context, client *model.BatchClient, job *aiplatformpb.BatchPredictionJob) (*aiplatformpb.BatchPredictionJob, error) {
+	state := job.GetState()
+	fmt.Fprintf(os.Stderr, "%s: %s\n", path.Base(job.GetName()), jobState(state))
+	for !model.JobDone(job) {
+		select {
+		case <-time.After(batchInterval):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped waiting for job %s, which continues to run", path.Base(job.GetName()))
+		}
+		var err error
+		job, err = client.Job(ctx, job.GetName())
+		if err != nil {
+			return nil, err
+		}
+		if job.GetState() != state {
+			state = job.GetState()
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path.Base(job.GetName()), jobState(state))
+		}
+	}
+	return job, nil
+}
+
+// batchJobInfo is the summary of a batch prediction job.
+type batchJobInfo struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	DisplayName  string     `json:"displayName"`
+	Model        string     `json:"model"`
+	State        string     `json:"state"`
+	Created      time.Time  `json:"created"`
+	Ended        *time.Time `json:"ended,omitempty"`
+	Input        string     `json:"input,omitempty"`
+	Output       string     `json:"output,omitempty"`
+	Succeeded    int64      `json:"succeeded"`
+	Failed       int64      `json:"failed"`
+	Incomplete   int64      `json:"incomplete"`
+	ErrorMessage string     `json:"error,omitempty"`
+}
+
+func newBatchJobInfo(job *aiplatformpb.BatchPredictionJob) batchJobInfo {
+	info := batchJobInfo{
+		ID:           path.Base(job.GetName()),
+		Name:         job.GetName(),
+		DisplayName:  job.GetDisplayName(),
+		Model:        path.Base(job.GetModel()),
+		State:        jobState(job.GetState()),
+		Created:      job.GetCreateTime().AsTime(),
+		Input:        strings.Join(job.GetInputConfig().GetGcsSource().GetUris(), ", "),
+		Output:       job.GetOutputInfo().GetGcsOutputDirectory(),
+		Succeeded:    job.GetCompletionStats().GetSuccessfulCount(),
+		Failed:       job.GetCompletionStats().GetFailedCount(),
+		Incomplete:   job.GetCompletionStats().GetIncompleteCount(),
+		ErrorMessage: job.GetError().GetMessage(),
+	}
+	if job.GetEndTime() != nil {
+		ended := job.GetEndTime().AsTime()
+		info.Ended = &ended
+	}
+	return info
+}
+
+// jobState returns a job state without its JOB_STATE_ prefix, such as RUNNING.
+func jobState(state aiplatformpb.JobState) string {
+	return strings.TrimPrefix(state.String(), "JOB_STATE_")
+}
+
+// showBatchJob writes a job's details as text or JSON.
+func showBatchJob(w io.Writer, job *aiplatformpb.BatchPredictionJob) error {
+	info := newBatchJobInfo(job)
+	if Outputtype == "json" {
+		jsonBytes, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(jsonBytes))
+		return nil
+	}
+
+	fmt.Fprintf(w, "id: %s\n", info.ID)
+	fmt.Fprintf(w, "name: %s\n", info.DisplayName)
+	fmt.Fprintf(w, "model: %s\n", info.Model)
+	fmt.Fprintf(w, "state: %s\n", info.State)
+	fmt.Fprintf(w, "created: %s\n", info.Created.Local().Format(time.RFC3339))
+	if info.Ended != nil {
+		fmt.Fprintf(w, "ended: %s\n", info.Ended.Local().Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "input: %s\n", info.Input)
+	if info.Output != "" {
+		fmt.Fprintf(w, "output: %s\n", info.Output)
+	}
+	if job.GetCompletionStats() != nil {
+		fmt.Fprintf(w, "requests: %d succeeded, %d failed, %d incomplete\n", info.Succeeded, info.Failed, info.Incomplete)
+	}
+	if info.ErrorMessage != "" {
+		fmt.Fprintf(w, "error: %s\n", info.ErrorMessage)
+	}
+	return nil
+}
+
+// listBatchJobs writes a table of jobs, or their JSON summaries.
+func listBatchJobs(w io.Writer, jobs []*aiplatformpb.BatchPredictionJob) error {
+	infos := make([]batchJobInfo, 0, len(jobs))
+	for _, job := range jobs {
+		infos = append(infos, newBatchJobInfo(job))
+	}
+	if Outputtype == "json" {
+		jsonBytes, err := json.Marshal(infos)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(jsonBytes))
+		return nil
+	}
+
+	data := [][]string{}
+	for _, info := range infos {
+		data = append(data, []string{
+			info.ID,
+			info.DisplayName,
+			info.Model,
+			info.State,
+			info.Created.Local().Format("2006-01-02 15:04"),
+		})
+	}
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"ID", "Name", "Model", "State", "Created"})
+	table.SetBorder(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.AppendBulk(data)
+	table.Render()
+	return nil
+}
+
+// downloadBatchResults writes the predictions of a finished job as batch results.
+func downloadBatchResults(cmd *cobra.Command, args []string) error {
+	// Gemini results, which don't carry an id, are labelled with the position of their prompt in the input
+	var items []batchItem
+	if batchInput != "" {
+		var err error
+		items, err = readBatchInput(batchInput)
+		if err != nil {
+			return err
+		}
+	}
+
+	cfg, err := newConfig()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	client, err := model.NewBatchClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	job, err := client.Job(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	outputDir := job.GetOutputInfo().GetGcsOutputDirectory()
+	if outputDir == "" {
+		return fmt.Errorf("job %s has no output yet, its state is %s", args[0], jobState(job.GetState()))
+	}
+
+	storage, err := gcs.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	uris, err := storage.List(ctx, strings.TrimSuffix(outputDir, "/")+"/")
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if batchOutput != "" {
+		f, err := os.Create(batchOutput)
+		if err != nil {
+			return fmt.Errorf("unable to create %s: %w", batchOutput, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	count := 0
+	for _, uri := range uris {
+		if path.Ext(uri) != ".jsonl" {
+			continue
+		}
+		r, err := storage.Download(ctx, uri)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			count++
+			if batchRaw {
+				fmt.Fprintln(w, scanner.Text())
+				continue
+			}
+			p, err := model.ParseBatchPrediction(scanner.Bytes())
+			if err != nil {
+				r.Close()
+				return fmt.Errorf("error reading %s: %w", uri, err)
+			}
+			if p.ID == "" && p.Index > 0 && p.Index <= len(items) {
+				p.ID = items[p.Index-1].ID
+			}
+			if err := enc.Encode(batchResult{ID: p.ID, Prompt: p.Prompt, Response: p.Response, Usage: p.Usage, Error: p.Error}); err != nil {
+				r.Close()
+				return fmt.Errorf("error writing result: %w", err)
+			}
+		}
+		r.Close()
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("error reading %s: %w", uri, err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d results from %s, job state %s\n", count, outputDir, jobState(job.GetState()))
+	return nil
+}
@@ -1,11 +1,14 @@
 package cmd
 
-import "github.com/spf13/cobra"
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
 
 var (
 	// TODO - Look at ways to remove the need to export these two variable outside the package
-	modelName string
-	//modelNames      []string // test for multiple models
+	modelName       string
 	modelConfigFile string
 	//modelConfig     map[string]interface{}
 
@@ -22,5 +25,12 @@ var (
 		Use:   "gen",
 		Short: "access generative ai on google cloud",
 		Long:  `gen is a command-line tool for interacting with Google Cloud hosted generative ai models - foundation, tuned, and Model Garden models.`,
+		// an output type that's meant as a file, such as gen logs export --output logs.jsonl, isn't ignored
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if Outputtype != "text" && Outputtype != "json" {
+				return fmt.Errorf("unknown output type %s, --output is text or json; see %s --help for the flag to write to a file", Outputtype, cmd.CommandPath())
+			}
+			return nil
+		},
 	}
 )
@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ghchinoy/gen/internal/model"
+)
+
+var (
+	compareModels []string
+	sideBySide    bool
+	compareWidth  int
+)
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+
+	compareCmd.PersistentFlags().StringArrayVarP(&compareModels, "model", "m", nil, "model name or alias, repeat for each model to compare")
+	compareCmd.PersistentFlags().StringVarP(&modelConfigFile, "config", "c", "", "model parameters")
+	compareCmd.PersistentFlags().StringVarP(&promptFile, "file", "f", "", "prompt from file")
+	compareCmd.PersistentFlags().StringVarP(&systemInstructions, "system", "s", "", "system instructions")
+	compareCmd.PersistentFlags().StringVar(&systemFile, "system-file", "", "system instructions from file")
+	compareCmd.PersistentFlags().StringArrayVarP(&attachFiles, "attach", "a", nil, "attach a file (image, PDF, audio, video, text), repeatable")
+	compareCmd.PersistentFlags().BoolVar(&sideBySide, "side-by-side", false, "show the responses in columns, rather than one after another")
+	compareCmd.PersistentFlags().IntVar(&compareWidth, "width", 0, "width of the side by side output (default is $COLUMNS, or 120)")
+}
+
+var compareCmd = &cobra.Command{
+	Use:     "compare",
+	Aliases: []string{"cmp"},
+	Short:   "Compare the responses of several models to a prompt",
+	Long: `Sends the same prompt to each model given with -m, concurrently, and shows the responses
+with their latency and token usage. Use --output json for a report to use in scripts.`,
+	Example: `  gen compare -m gemini-2.5-flash -m claude-3-5-sonnet@20240620 "say something nice to me"`,
+	RunE:    compareE,
+}
+
+// comparison is the response of one model in a comparison.
+type comparison struct {
+	Model      string       `json:"model"`
+	System     string       `json:"system,omitempty"`
+	Response   string       `json:"response"`
+	LatencyMs  int64        `json:"latencyMs"`
+	FirstMs    int64        `json:"firstTokenMs,omitempty"`
+	Usage      *model.Usage `json:"usage,omitempty"`
+	Cost       *float64     `json:"estimatedCost,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	latency    time.Duration
+	firstToken time.Duration
+}
+
+// comparisonReport is the JSON report of a comparison.
+type comparisonReport struct {
+	Prompt  string       `json:"prompt"`
+	System  string       `json:"system,omitempty"`
+	Results []comparison `json:"results"`
+}
+
+// compareE prompts each model concurrently and writes their responses.
+func compareE(cmd *cobra.Command, args []string) error {
+	if len(compareModels) < 2 {
+		return fmt.Errorf("requires at least two models to compare, use -m for each")
+	}
+	for i, name := range compareModels {
+		resolved, err := resolveModel(name)
+		if err != nil {
+			return err
+		}
+		compareModels[i] = resolved
+	}
+
+	var prompt string
+	if promptFile != "" {
+		promptBytes, err := os.ReadFile(promptFile)
+		if err != nil {
+			return fmt.Errorf("unable to read file %s: %w", promptFile, err)
+		}
+		prompt = string(promptBytes)
+	} else {
+		if len(args) == 0 {
+			return fmt.Errorf("please provide prompt")
+		}
+		prompt = strings.Join(args, " ")
+	}
+
+	cfg, err := newConfig()
+	if err != nil {
+		return err
+	}
+	// responses are buffered as text, the JSON output is the report
+	cfg.OutputType = "text"
+
+	system, err := readSystemInstructions()
+	if err != nil {
+		return err
+	}
+
+	// each model is prompted with its own defaults of gen.yaml, unless given as flags
+	configs := make([]model.Config, len(compareModels))
+	convs := make([]*model.Conversation, len(compareModels))
+	for i, name := range compareModels {
+		attachments, err := loadAttachments(name, attachFiles)
+		if err != nil {
+			return err
+		}
+		configs[i] = cfg
+		convs[i] = &model.Conversation{System: system}
+		if err := applyModelDefaults(&configs[i], name, convs[i]); err != nil {
+			return err
+		}
+		convs[i].AddUser(prompt, attachments...)
+	}
+
+	ctx := context.Background()
+	results := make([]comparison, len(compareModels))
+	var wg sync.WaitGroup
+	for i, name := range compareModels {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = compareModel(ctx, configs[i], name, convs[i])
+		}()
+	}
+	wg.Wait()
+	for i, conv := range convs {
+		// the system instructions of the model's defaults, rather than --system
+		if conv.System != system {
+			results[i].System = conv.System
+		}
+	}
+
+	if Outputtype == "json" {
+		jsonBytes, err := json.MarshalIndent(comparisonReport{Prompt: prompt, System: system, Results: results}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(jsonBytes))
+		return nil
+	}
+
+	if sideBySide {
+		writeSideBySide(os.Stdout, results)
+	} else {
+		for _, r := range results {
+			fmt.Printf("=== %s ===\n", r.Model)
+			if r.Error != "" {
+				fmt.Printf("error: %s\n\n", r.Error)
+				continue
+			}
+			fmt.Printf("%s\n\n", strings.TrimSpace(r.Response))
+		}
+	}
+	writeComparisonStats(os.Stdout, results)
+	return nil
+}
+
+// compareModel generates a response from one model, recording its latency and usage.
+func compareModel(ctx context.Context, cfg model.Config, modelName string, conv *model.Conversation) comparison {
+	result := comparison{Model: modelName}
+	client, err := model.NewClient(ctx, cfg, modelName)
+	if err != nil {
+		result.Error = fmt.Sprintf("error creating client: %v", err)
+		return result
+	}
+	defer client.Close()
+
+	var buf bytes.Buffer
+	start := time.Now()
+	w := &firstWriteTimer{w: &buf, start: start}
+	err = client.GenerateChat(ctx, w, conv, cfg.ModelParameters)
+	result.latency = time.Since(start)
+	result.firstToken = w.first
+	result.LatencyMs = result.latency.Milliseconds()
+	result.FirstMs = result.firstToken.Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		result.Response = buf.String()
+		return result
+	}
+	logExchange("", modelName, cfg.ModelParameters, conv, result.latency)
+
+	result.Response = conv.Messages[len(conv.Messages)-1].Text
+	result.Usage = conv.LastUsage()
+	if result.Usage != nil {
+		if price, err := model.GetPrice(modelName, pricingOverrides()); err == nil {
+			cost := price.Cost(*result.Usage)
+			result.Cost = &cost
+		}
+	}
+	return result
+}
+
+// firstWriteTimer records the time of the first streamed write, the time to first token.
+type firstWriteTimer struct {
+	w     io.Writer
+	start time.Time
+	first time.Duration
+}
+
+func (t *firstWriteTimer) Write(p []byte) (int, error) {
+	if t.first == 0 && len(p) > 0 {
+		t.first = time.Since(t.start)
+	}
+	return t.w.Write(p)
+}
+
+// writeSideBySide writes the responses in a column per model.
+func writeSideBySide(w io.Writer, results []comparison) {
+	width := compareWidth
+	if width <= 0 {
+		width, _ = strconv.Atoi(os.Getenv("COLUMNS"))
+	}
+	if width <= 0 {
+		width = 120
+	}
+
+	header := make([]string, 0, len(results))
+	row := make([]string, 0, len(results))
+	for _, r := range results {
+		header = append(header, r.Model)
+		if r.Error != "" {
+			row = append(row, "error: "+r.Error)
+			continue
+		}
+		row = append(row, strings.TrimSpace(r.Response))
+	}
+
+	table := tablewriter.NewWriter(w)
+	table.SetHeader(header)
+	table.SetAutoFormatHeaders(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	// leave room for the column separators
+	table.SetColWidth(max(20, (width-3*len(results))/len(results)))
+	table.Append(row)
+	table.Render()
+	fmt.Fprintln(w)
+}
+
+// writeComparisonStats writes a table of each model's latency, token usage and estimated cost.
+func writeComparisonStats(w io.Writer, results []comparison) {
+	data := [][]string{}
+	for _, r := range results {
+		input, output, cost := "-", "-", "-"
+		if r.Usage != nil {
+			input = strconv.Itoa(r.Usage.InputTokens)
+			output = strconv.Itoa(r.Usage.OutputTokens)
+		}
+		if r.Cost != nil {
+			cost = fmt.Sprintf("$%.6f", *r.Cost)
+		}
+		status := "ok"
+		if r.Error != "" {
+			status = "error"
+		}
+		data = append(data, []string{
+			r.Model,
+			status,
+			r.latency.Round(time.Millisecond).String(),
+			r.firstToken.Round(time.Millisecond).String(),
+			input,
+			output,
+			cost,
+		})
+	}
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Model", "Status", "Latency", "First token", "Input tokens", "Output tokens", "Estimated cost"})
+	table.SetBorder(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.AppendBulk(data)
+	table.Render()
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ghchinoy/gen/internal/history"
+	"github.com/spf13/cobra"
+)
+
+var (
+	continueLast   bool
+	conversationID string
+)
+
+// resumeConversation returns the saved conversation given with --continue or --conversation,
+// or a new conversation when neither is set.
+// A resumed conversation keeps its model and system instructions, unless --model or --system are given,
+// or modelChosen reports the model was otherwise chosen, as by a template.
+func resumeConversation(cmd *cobra.Command, modelChosen bool) (*history.Conversation, error) {
+	system, err := readSystemInstructions()
+	if err != nil {
+		return nil, err
+	}
+	if !continueLast && conversationID == "" {
+		c := &history.Conversation{ID: history.NewID(), Model: modelName}
+		c.System = system
+		return c, nil
+	}
+	if continueLast && conversationID != "" {
+		return nil, fmt.Errorf("use either --continue or --conversation, not both")
+	}
+
+	store, err := history.OpenDefault()
+	if err != nil {
+		return nil, err
+	}
+	var c *history.Conversation
+	if continueLast {
+		c, err = store.LastConversation()
+	} else {
+		c, err = store.GetConversation(conversationID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cmd.Flag("model").Changed || modelChosen {
+		c.Model = modelName
+	} else {
+		modelName = c.Model
+	}
+	if system != "" {
+		c.System = system
+	}
+	return c, nil
+}
+
+// saveConversation saves a conversation so it can be continued, unless --no-log is set.
+// Failing to save is reported, but doesn't fail the command.
+func saveConversation(c *history.Conversation) {
+	if noLog {
+		return
+	}
+	store, err := history.OpenDefault()
+	if err == nil {
+		err = store.SaveConversation(c)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to save conversation: %v\n", err)
+	}
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ghchinoy/gen/internal/model"
+)
+
+var (
+	embedFiles     []string
+	embedInput     string
+	embedOutput    string
+	embedFormat    string
+	embedTaskType  string
+	embedTitle     string
+	embedDimension int32
+)
+
+func init() {
+	rootCmd.AddCommand(embedCmd)
+
+	embedCmd.Flags().StringVarP(&modelName, "model", "m", "text-embedding-005", "embedding model name")
+	embedCmd.Flags().StringArrayVarP(&embedFiles, "file", "f", nil, "embed a file's text, repeatable")
+	embedCmd.Flags().StringVarP(&embedInput, "input", "i", "", "JSON lines file of texts, one {\"id\": \"...\", \"text\": \"...\"} per line")
+	embedCmd.Flags().StringVarP(&embedOutput, "output", "o", "", "file to write the embeddings to (default is stdout)")
+	embedCmd.Flags().StringVar(&embedFormat, "format", "json", "embeddings format, json, jsonl or csv")
+	embedCmd.Flags().StringVarP(&embedTaskType, "task-type", "t", "", "task type, such as RETRIEVAL_DOCUMENT, RETRIEVAL_QUERY, SEMANTIC_SIMILARITY, CLASSIFICATION or CLUSTERING")
+	embedCmd.Flags().StringVar(&embedTitle, "title", "", "title of the texts, for the RETRIEVAL_DOCUMENT task type")
+	embedCmd.Flags().Int32Var(&embedDimension, "dimensions", 0, "output dimensionality, for models that support smaller embeddings")
+}
+
+var embedCmd = &cobra.Command{
+	Use:     "embed",
+	Aliases: []string{"e", "embeddings"},
+	Short:   "Embed text with an embedding model",
+	Long: `Returns the embedding vectors of texts, given as arguments, files with --file, or a JSON lines file with --input.
+Gemini embedding models, such as gemini-embedding-001, and Vertex AI text embedding models, such as text-embedding-005,
+are supported; see gen models for the embeddings models.`,
+	Example: `  gen embed "the quick brown fox"
+  gen embed -m gemini-embedding-001 --task-type RETRIEVAL_DOCUMENT --dimensions 768 -f README.md
+  gen embed -i texts.jsonl --format csv -o embeddings.csv`,
+	RunE: embedE,
+}
+
+// embedText is a text to embed.
+type embedText struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// embedRecord is the embedding of a text, as written by gen embed.
+type embedRecord struct {
+	ID        string    `json:"id"`
+	Embedding []float32 `json:"embedding"`
+	Tokens    int       `json:"tokens,omitempty"`
+	Truncated bool      `json:"truncated,omitempty"`
+}
+
+// embedE embeds the given texts and writes their embeddings.
+func embedE(cmd *cobra.Command, args []string) error {
+	if !cmd.Flag("model").Changed {
+		modelName = "text-embedding-005"
+	}
+	switch embedFormat {
+	case "json", "jsonl", "csv":
+	default:
+		return fmt.Errorf("unknown embeddings format %s, use json, jsonl or csv", embedFormat)
+	}
+
+	texts, err := readEmbedTexts(args)
+	if err != nil {
+		return err
+	}
+	if len(texts) == 0 {
+		return fmt.Errorf("please provide text to embed")
+	}
+
+	cfg, err := newConfig()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	client, err := model.NewEmbeddingClient(ctx, cfg, modelName)
+	if err != nil {
+		return fmt.Errorf("error creating client: %w", err)
+	}
+
+	values := make([]string, 0, len(texts))
+	for _, t := range texts {
+		values = append(values, t.Text)
+	}
+	embeddings, err := client.Embed(ctx, values, model.EmbedOptions{
+		TaskType:       embedTaskType,
+		Dimensionality: embedDimension,
+		Title:          embedTitle,
+	})
+	if err != nil {
+		return err
+	}
+
+	records := make([]embedRecord, 0, len(embeddings))
+	for i, e := range embeddings {
+		records = append(records, embedRecord{ID: texts[i].ID, Embedding: e.Values, Tokens: e.Tokens, Truncated: e.Truncated})
+	}
+
+	var w io.Writer = os.Stdout
+	if embedOutput != "" {
+		f, err := os.Create(embedOutput)
+		if err != nil {
+			return fmt.Errorf("unable to create %s: %w", embedOutput, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	return writeEmbeddings(w, embedFormat, records)
+}
+
+// readEmbedTexts returns the texts from the arguments, --file and --input.
+// The arguments are embedded as one text, like a prompt.
+func readEmbedTexts(args []string) ([]embedText, error) {
+	var texts []embedText
+	if len(args) > 0 {
+		texts = append(texts, embedText{ID: "1", Text: strings.Join(args, " ")})
+	}
+	for _, path := range embedFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read file %s: %w", path, err)
+		}
+		texts = append(texts, embedText{ID: path, Text: string(data)})
+	}
+	if embedInput == "" {
+		return texts, nil
+	}
+
+	f, err := os.Open(embedInput)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file %s: %w", embedInput, err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var item struct {
+			ID   json.RawMessage `json:"id"`
+			Text string          `json:"text"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			return nil, fmt.Errorf("error reading %s: line %d: %w", embedInput, line, err)
+		}
+		if item.Text == "" {
+			return nil, fmt.Errorf("error reading %s: line %d: missing text", embedInput, line)
+		}
+		t := embedText{ID: strconv.Itoa(line), Text: item.Text}
+		if len(item.ID) > 0 && string(item.ID) != "null" {
+			if err := json.Unmarshal(item.ID, &t.ID); err != nil {
+				t.ID = string(item.ID)
+			}
+		}
+		texts = append(texts, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", embedInput, err)
+	}
+	return texts, nil
+}
+
+// writeEmbeddings writes embeddings as a JSON array, JSON lines, or CSV rows of the id and vector.
+func writeEmbeddings(w io.Writer, format string, records []embedRecord) error {
+	switch format {
+	case "jsonl":
+		enc := json.NewEncoder(w)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		for _, r := range records {
+			row := make([]string, 0, len(r.Embedding)+1)
+			row = append(row, r.ID)
+			for _, v := range r.Embedding {
+				row = append(row, strconv.FormatFloat(float64(v), 'g', -1, 32))
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	jsonBytes, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, string(jsonBytes))
+	return nil
+}
@@ -0,0 +1,360 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ghchinoy/gen/internal/history"
+	"github.com/ghchinoy/gen/internal/index"
+	"github.com/ghchinoy/gen/internal/model"
+)
+
+var (
+	indexFile    string
+	chunkSize    int
+	chunkOverlap int
+	searchTopK   int
+)
+
+// maxIndexFileSize is the size of the largest file gen index add embeds.
+const maxIndexFileSize = 1 << 20
+
+func init() {
+	rootCmd.AddCommand(indexCmd, searchCmd)
+	indexCmd.AddCommand(indexAddCmd, indexListCmd, indexRemoveCmd)
+
+	indexCmd.PersistentFlags().StringVar(&indexFile, "index", "", "index file, named *.index.json (default is $HOME/.config/gen/default.index.json)")
+	indexAddCmd.Flags().StringVarP(&modelName, "model", "m", "text-embedding-005", "embedding model name, for a new index")
+	indexAddCmd.Flags().IntVar(&chunkSize, "chunk-size", 1500, "approximate size of each chunk, in characters")
+	indexAddCmd.Flags().IntVar(&chunkOverlap, "chunk-overlap", 200, "approximate overlap between chunks, in characters")
+
+	searchCmd.Flags().StringVar(&indexFile, "index", "", "index file, named *.index.json (default is $HOME/.config/gen/default.index.json)")
+	searchCmd.Flags().IntVarP(&searchTopK, "top", "k", 5, "number of chunks to return")
+}
+
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Manage a local index of embedded documents",
+	Long: `Documents added to the index are split into chunks of lines, embedded with an embedding model,
+and kept in a local file, to be searched with gen search.`,
+}
+
+var indexAddCmd = &cobra.Command{
+	Use:   "add <files or directories>",
+	Short: "Chunk, embed and add files to the index",
+	Long: `Splits text files into chunks, embeds them and adds them to the index, replacing any earlier version of the files.
+Directories are added recursively, skipping hidden files and directories, binary files and files over 1MB.
+Files unchanged since they were added are skipped.`,
+	Example: `  gen index add README.md docs/
+  gen index add -m gemini-embedding-001 --index ./project.index.json internal/`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: addToIndex,
+}
+
+var indexListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List the files in the index",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ix, err := openIndex()
+		if err != nil {
+			return err
+		}
+		counts := map[string]int{}
+		for _, c := range ix.Chunks {
+			counts[c.Source]++
+		}
+		sources := make([]string, 0, len(ix.Files))
+		for source := range ix.Files {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+
+		if Outputtype == "json" {
+			jsonBytes, err := json.Marshal(counts)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(jsonBytes))
+			return nil
+		}
+		fmt.Printf("index: %s\nmodel: %s\n\n", ix.Path(), ix.Model)
+		data := [][]string{}
+		for _, source := range sources {
+			data = append(data, []string{displayPath(source), strconv.Itoa(counts[source])})
+		}
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"File", "Chunks"})
+		table.SetBorder(false)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.AppendBulk(data)
+		table.Render()
+		return nil
+	},
+}
+
+var indexRemoveCmd = &cobra.Command{
+	Use:     "remove <files>",
+	Aliases: []string{"rm"},
+	Short:   "Remove files from the index",
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ix, err := openIndex()
+		if err != nil {
+			return err
+		}
+		for _, arg := range args {
+			source, err := filepath.Abs(arg)
+			if err != nil {
+				return err
+			}
+			if _, ok := ix.Files[source]; !ok {
+				return fmt.Errorf("%s isn't in the index", arg)
+			}
+			fmt.Printf("removed %s, %d chunks\n", arg, ix.Remove(source))
+		}
+		return ix.Save()
+	},
+}
+
+var searchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Search the index for the chunks most similar to a query",
+	Long:  `Embeds the query with the index's embedding model and returns the top chunks by cosine similarity.`,
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ix, err := openIndex()
+		if err != nil {
+			return err
+		}
+		cfg, err := newConfig()
+		if err != nil {
+			return err
+		}
+		results, err := searchIndex(context.Background(), cfg, ix, strings.Join(args, " "), searchTopK)
+		if err != nil {
+			return err
+		}
+		return writeSearchResults(os.Stdout, results)
+	},
+}
+
+// openIndex opens the index given with --index, or the default index.
+func openIndex() (*index.Index, error) {
+	path := indexFile
+	if path == "" {
+		dir, err := history.DefaultDir()
+		if err != nil {
+			return nil, err
+		}
+		path = index.DefaultPath(dir)
+	}
+	return index.Open(path)
+}
+
+// addToIndex chunks, embeds and indexes the files, and the text files in the directories.
+func addToIndex(cmd *cobra.Command, args []string) error {
+	ix, err := openIndex()
+	if err != nil {
+		return err
+	}
+	if !cmd.Flag("model").Changed {
+		modelName = "text-embedding-005"
+	}
+	if ix.Model == "" {
+		ix.Model = modelName
+	} else if cmd.Flag("model").Changed && modelName != ix.Model {
+		return fmt.Errorf("index %s is embedded with %s; use the same model, or a new index with --index", ix.Path(), ix.Model)
+	}
+
+	cfg, err := newConfig()
+	if err != nil {
+		return err
+	}
+	return updateIndex(context.Background(), cfg, ix, args, os.Stdout)
+}
+
+// updateIndex chunks, embeds and indexes the files, and the text files in the directories,
+// reporting each file on w and saving the index when files were added.
+func updateIndex(ctx context.Context, cfg model.Config, ix *index.Index, paths []string, w io.Writer) error {
+	files, err := indexFiles(paths)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	client, err := model.NewEmbeddingClient(ctx, cfg, ix.Model)
+	if err != nil {
+		return fmt.Errorf("error creating client: %w", err)
+	}
+
+	added := 0
+	for _, path := range files {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("unable to read file %s: %w", path, err)
+		}
+		source, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		hash := index.Hash(content)
+		if ix.Files[source] == hash {
+			fmt.Fprintf(w, "unchanged %s\n", path)
+			continue
+		}
+
+		chunks := index.Split(source, string(content), chunkSize, chunkOverlap)
+		texts := make([]string, 0, len(chunks))
+		for _, c := range chunks {
+			texts = append(texts, c.Text)
+		}
+		embeddings, err := client.Embed(ctx, texts, model.EmbedOptions{TaskType: "RETRIEVAL_DOCUMENT", Title: filepath.Base(path)})
+		if err != nil {
+			// keep the files embedded so far
+			if added > 0 {
+				_ = ix.Save()
+			}
+			return fmt.Errorf("error embedding %s: %w", path, err)
+		}
+		for i := range chunks {
+			chunks[i].Embedding = embeddings[i].Values
+		}
+		ix.Add(source, hash, chunks)
+		added++
+		fmt.Fprintf(w, "added %s, %d chunks\n", path, len(chunks))
+	}
+	if added == 0 {
+		return nil
+	}
+	return ix.Save()
+}
+
+// indexFiles returns the files to index, walking directories for text files.
+func indexFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != arg && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			// an index in the directory isn't a document
+			if d.IsDir() || index.IsFile(path) {
+				return nil
+			}
+			if ok, err := isTextFile(path); err != nil || !ok {
+				return err
+			}
+			files = append(files, path)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// isTextFile reports whether a file is small enough to index and looks like text.
+func isTextFile(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() == 0 || info.Size() > maxIndexFileSize {
+		return false, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	contentType := http.DetectContentType(head[:n])
+	return strings.HasPrefix(contentType, "text/"), nil
+}
+
+// searchIndex returns the chunks of the index most similar to a query.
+func searchIndex(ctx context.Context, cfg model.Config, ix *index.Index, query string, k int) ([]index.Result, error) {
+	if len(ix.Chunks) == 0 {
+		return nil, fmt.Errorf("index %s is empty, add files with gen index add", ix.Path())
+	}
+	client, err := model.NewEmbeddingClient(ctx, cfg, ix.Model)
+	if err != nil {
+		return nil, fmt.Errorf("error creating client: %w", err)
+	}
+	embeddings, err := client.Embed(ctx, []string{query}, model.EmbedOptions{TaskType: "RETRIEVAL_QUERY"})
+	if err != nil {
+		return nil, err
+	}
+	return ix.Search(embeddings[0].Values, k), nil
+}
+
+// writeSearchResults writes search results as text or JSON.
+func writeSearchResults(w io.Writer, results []index.Result) error {
+	if Outputtype == "json" {
+		type result struct {
+			Source    string  `json:"source"`
+			StartLine int     `json:"startLine"`
+			EndLine   int     `json:"endLine"`
+			Score     float64 `json:"score"`
+			Text      string  `json:"text"`
+		}
+		out := make([]result, 0, len(results))
+		for _, r := range results {
+			out = append(out, result{r.Source, r.StartLine, r.EndLine, r.Score, r.Text})
+		}
+		jsonBytes, err := json.Marshal(out)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(jsonBytes))
+		return nil
+	}
+
+	for i, r := range results {
+		fmt.Fprintf(w, "%d. %s:%d-%d (%.3f)\n", i+1, displayPath(r.Source), r.StartLine, r.EndLine, r.Score)
+		fmt.Fprintf(w, "%s\n\n", strings.TrimRight(r.Text, "\n"))
+	}
+	return nil
+}
+
+// displayPath returns a path relative to the working directory, when it's inside it.
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
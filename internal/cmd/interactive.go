@@ -2,12 +2,14 @@ package cmd
 
 import (
 	"bufio"
-	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/ghchinoy/gen/internal/history"
 	"github.com/ghchinoy/gen/internal/model"
 	"github.com/spf13/cobra"
 )
@@ -15,28 +17,51 @@ import (
 func init() {
 	rootCmd.AddCommand(interactiveCmd)
 
-	interactiveCmd.PersistentFlags().StringVarP(&modelName, "model", "m", "gemini-2.5-flash", "model name")
+	interactiveCmd.PersistentFlags().StringVarP(&modelName, "model", "m", defaultModelName, "model name or alias, defaults to the defaultModel of gen.yaml")
+	interactiveCmd.PersistentFlags().StringVarP(&modelConfigFile, "config", "c", "", "model parameters")
+	interactiveCmd.PersistentFlags().StringVarP(&systemInstructions, "system", "s", "", "system instructions")
+	interactiveCmd.PersistentFlags().StringVar(&systemFile, "system-file", "", "system instructions from file")
+	interactiveCmd.PersistentFlags().BoolVar(&showUsage, "usage", false, "print token usage and estimated cost, with a running total")
+	interactiveCmd.PersistentFlags().BoolVar(&continueLast, "continue", false, "continue the last conversation")
+	interactiveCmd.PersistentFlags().StringVar(&conversationID, "conversation", "", "continue the conversation with this id")
+	interactiveCmd.PersistentFlags().StringArrayVar(&toolFiles, "tools", nil, "YAML or JSON file of tools the model can call, repeatable")
+	interactiveCmd.PersistentFlags().StringArrayVar(&toolNames, "tool", nil, "a tool defined in gen.yaml the model can call, repeatable")
+	interactiveCmd.PersistentFlags().StringArrayVar(&mcpServerNames, "mcp", nil, "an MCP server in gen.yaml whose tools the model can call, repeatable")
+	interactiveCmd.PersistentFlags().BoolVarP(&approveAll, "yes", "y", false, "run tool calls without asking for confirmation")
 }
 
 var interactiveCmd = &cobra.Command{
 	Use:     "interactive",
 	Aliases: []string{"i"},
 	Short:   "Interactive mode",
-	Long:    `Interactive mode is a chat mode where you can interact with the model.`,
-	RunE:    interactiveMode,
+	Long: `Interactive mode is a chat mode where you can interact with the model.
+Conversations are saved locally, and can be resumed with --continue or --conversation <id>.`,
+	RunE: interactiveMode,
 }
 
 func interactiveMode(cmd *cobra.Command, args []string) error {
+	if err := selectModel(cmd); err != nil {
+		return err
+	}
+	saved, err := resumeConversation(cmd, false)
+	if err != nil {
+		return err
+	}
+
 	fmt.Println("entering interactive mode")
-	fmt.Println("type 'exit' or 'quit' to exit")
+	fmt.Println("type 'exit' or 'quit' to exit, '/attach <file>' to attach a file to your next message")
 	fmt.Printf("model: %s\n", modelName)
+	if len(saved.Messages) > 0 {
+		fmt.Printf("continuing conversation %s\n\n", saved.ID)
+		printConversation(saved)
+	}
 
-	cfg := model.Config{
-		ProjectID:  projectID,
-		RegionID:   region,
-		ConfigFile: cfgFile,
-		OutputType: Outputtype,
-		LogType:    Logtype,
+	cfg, err := newConfig()
+	if err != nil {
+		return err
+	}
+	if err := applyModelDefaults(&cfg, modelName, &saved.Conversation); err != nil {
+		return err
 	}
 
 	ctx := context.Background()
@@ -45,24 +70,97 @@ func interactiveMode(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("error creating client: %w", err)
 	}
+	defer client.Close()
 
+	runner, stopTools, err := startTools(ctx)
+	defer stopTools()
+	if err != nil {
+		return err
+	}
+	if runner != nil {
+		names := make([]string, 0, len(runner.declarations))
+		for _, d := range runner.declarations {
+			names = append(names, d.Name)
+		}
+		fmt.Printf("tools: %s\n", strings.Join(names, ", "))
+	}
+
+	conv := &saved.Conversation
+	var attachments []model.Attachment
+	var total model.Usage
+	input := bufio.NewScanner(os.Stdin)
 	for {
 		fmt.Print("? ")
-		input := bufio.NewScanner(os.Stdin)
-		input.Scan()
-
-		var buf bytes.Buffer
+		if !input.Scan() {
+			return input.Err()
+		}
 
 		// quit | exit
 		if strings.EqualFold(input.Text(), "quit") || strings.EqualFold(input.Text(), "exit") {
 			return nil
 		}
 
-		err := client.GenerateContent(ctx, &buf, input.Text(), nil)
-		if err != nil {
+		// /attach <file> queues a file for the next message
+		if path, ok := strings.CutPrefix(input.Text(), "/attach "); ok {
+			attached, err := loadAttachments(modelName, []string{strings.TrimSpace(path)})
+			if err != nil {
+				fmt.Printf("error attaching file: %v\n\n", err)
+				continue
+			}
+			attachments = append(attachments, attached...)
+			fmt.Printf("attached %s (%s)\n\n", attached[0].Name, attached[0].MIMEType)
+			continue
+		}
+
+		turn := len(conv.Messages)
+		conv.AddUser(input.Text(), attachments...)
+		attachments = nil
+		usage, err := generateWithTools(ctx, client, os.Stdout, conv, cfg.ModelParameters, runner, func(latency time.Duration) {
+			logExchange(saved.ID, modelName, cfg.ModelParameters, conv, latency)
+		})
+		if err == nil {
+			saveConversation(saved)
+		} else {
 			fmt.Printf("error generating content: %v\n", err)
+			// drop the unanswered turn, with any tool calls, so the conversation stays alternating
+			conv.Messages = conv.Messages[:turn]
 		}
 
-		fmt.Printf("%s\n\n", buf.String())
+		fmt.Print("\n\n")
+		if showUsage && err == nil && usage != nil {
+			total = total.Add(*usage)
+			printUsage(os.Stdout, "usage", modelName, *usage)
+			printUsage(os.Stdout, "total", modelName, total)
+			fmt.Println()
+		}
+	}
+}
+
+// printConversation writes the earlier turns of a resumed conversation, as they appeared in interactive mode.
+func printConversation(c *history.Conversation) {
+	for _, m := range c.Messages {
+		if len(m.ToolResults) > 0 {
+			for _, result := range m.ToolResults {
+				fmt.Printf("tool result: %s\n", result.Name)
+			}
+			continue
+		}
+		if m.Role == model.RoleUser {
+			for _, a := range m.Attachments {
+				fmt.Printf("attached %s (%s)\n", a.Name, a.MIMEType)
+			}
+			fmt.Printf("? %s\n", m.Text)
+			continue
+		}
+		if m.Text != "" {
+			fmt.Printf("%s\n", m.Text)
+		}
+		for _, call := range m.ToolCalls {
+			args, _ := json.Marshal(call.Args)
+			fmt.Printf("tool call: %s %s\n", call.Name, args)
+		}
+		if len(m.ToolCalls) == 0 {
+			fmt.Println()
+		}
 	}
 }
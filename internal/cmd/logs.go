@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ghchinoy/gen/internal/history"
+	"github.com/ghchinoy/gen/internal/model"
+)
+
+var (
+	noLog        bool
+	logsLimit    int
+	exportFormat string
+	exportFile   string
+)
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+	logsCmd.AddCommand(logsListCmd, logsShowCmd, logsSearchCmd, logsExportCmd)
+
+	logsListCmd.Flags().IntVarP(&logsLimit, "limit", "n", 20, "number of most recent logs to list, 0 for all")
+	logsSearchCmd.Flags().IntVarP(&logsLimit, "limit", "n", 20, "number of most recent matches to list, 0 for all")
+	logsExportCmd.Flags().StringVar(&exportFormat, "format", "jsonl", "export format, jsonl or json")
+	logsExportCmd.Flags().StringVarP(&exportFile, "out", "o", "", "file to export to (default is stdout)")
+}
+
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Browse logged prompts and responses",
+	Long: `Every prompt and response from gen prompt and gen interactive is logged to $HOME/.config/gen/logs.jsonl,
+with the model, parameters, usage and latency. Use --no-log to skip logging.`,
+}
+
+var logsListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List recent logs",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := history.OpenDefault()
+		if err != nil {
+			return err
+		}
+		entries, err := store.List()
+		if err != nil {
+			return err
+		}
+		return listEntries(os.Stdout, entries)
+	},
+}
+
+var logsShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show a log",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := history.OpenDefault()
+		if err != nil {
+			return err
+		}
+		e, err := store.Get(args[0])
+		if err != nil {
+			return err
+		}
+		if Outputtype == "json" {
+			jsonBytes, err := json.MarshalIndent(e, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(jsonBytes))
+			return nil
+		}
+		showEntry(os.Stdout, e)
+		return nil
+	},
+}
+
+var logsSearchCmd = &cobra.Command{
+	Use:   "search <text>",
+	Short: "Search logs for text in the model, system instructions, prompt or response",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := history.OpenDefault()
+		if err != nil {
+			return err
+		}
+		entries, err := store.Search(strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		return listEntries(os.Stdout, entries)
+	},
+}
+
+var logsExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export all logs as JSON lines or a JSON array",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := history.OpenDefault()
+		if err != nil {
+			return err
+		}
+		entries, err := store.List()
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if exportFile != "" {
+			f, err := os.Create(exportFile)
+			if err != nil {
+				return fmt.Errorf("unable to create %s: %w", exportFile, err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		switch exportFormat {
+		case "jsonl":
+			enc := json.NewEncoder(w)
+			for _, e := range entries {
+				if err := enc.Encode(e); err != nil {
+					return err
+				}
+			}
+		case "json":
+			if entries == nil {
+				entries = []history.Entry{}
+			}
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(entries)
+		default:
+			return fmt.Errorf("unknown export format %s, use jsonl or json", exportFormat)
+		}
+		return nil
+	},
+}
+
+// listEntries writes the most recent entries, newest first, as a table or JSON.
+func listEntries(w io.Writer, entries []history.Entry) error {
+	if logsLimit > 0 && len(entries) > logsLimit {
+		entries = entries[len(entries)-logsLimit:]
+	}
+	recent := make([]history.Entry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		recent = append(recent, entries[i])
+	}
+
+	if Outputtype == "json" {
+		jsonBytes, err := json.Marshal(recent)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(jsonBytes))
+		return nil
+	}
+
+	data := [][]string{}
+	for _, e := range recent {
+		data = append(data, []string{
+			e.ID,
+			e.Timestamp.Local().Format("2006-01-02 15:04"),
+			e.Model,
+			truncate(e.Prompt, 60),
+		})
+	}
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"ID", "Time", "Model", "Prompt"})
+	table.SetBorder(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.AppendBulk(data)
+	table.Render()
+	return nil
+}
+
+// showEntry writes an entry as text.
+func showEntry(w io.Writer, e history.Entry) {
+	fmt.Fprintf(w, "id: %s\n", e.ID)
+	if e.ConversationID != "" {
+		fmt.Fprintf(w, "conversation: %s\n", e.ConversationID)
+	}
+	fmt.Fprintf(w, "time: %s\n", e.Timestamp.Local().Format(time.RFC3339))
+	fmt.Fprintf(w, "model: %s\n", e.Model)
+	if params, _ := json.Marshal(e.Parameters); string(params) != "{}" {
+		fmt.Fprintf(w, "parameters: %s\n", params)
+	}
+	fmt.Fprintf(w, "latency: %s\n", time.Duration(e.LatencyMs)*time.Millisecond)
+	if e.Usage != nil {
+		fmt.Fprintf(w, "usage: input tokens: %d, output tokens: %d, cached tokens: %d\n", e.Usage.InputTokens, e.Usage.OutputTokens, e.Usage.CachedTokens)
+	}
+	if len(e.Attachments) > 0 {
+		fmt.Fprintf(w, "attachments: %s\n", strings.Join(e.Attachments, ", "))
+	}
+	if e.System != "" {
+		fmt.Fprintf(w, "\nsystem:\n%s\n", e.System)
+	}
+	fmt.Fprintf(w, "\nprompt:\n%s\n\nresponse:\n%s\n", e.Prompt, e.Response)
+}
+
+// truncate shortens text to a single line of at most n characters.
+func truncate(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// logExchange records the last prompt and response of a conversation, unless --no-log is set.
+// Failing to log is reported, but doesn't fail the command.
+func logExchange(conversationID, modelName string, params model.GenerationParameters, conv *model.Conversation, latency time.Duration) {
+	if noLog || len(conv.Messages) < 2 {
+		return
+	}
+	prompt := conv.Messages[len(conv.Messages)-2]
+	response := conv.Messages[len(conv.Messages)-1]
+
+	var attachments []string
+	for _, a := range prompt.Attachments {
+		attachments = append(attachments, a.Name)
+	}
+
+	store, err := history.OpenDefault()
+	if err == nil {
+		err = store.Append(history.Entry{
+			ID:             history.NewID(),
+			ConversationID: conversationID,
+			Timestamp:      time.Now().UTC(),
+			Model:          modelName,
+			Parameters:     params,
+			System:         conv.System,
+			Prompt:         messageText(prompt),
+			Attachments:    attachments,
+			Response:       messageText(response),
+			Usage:          response.Usage,
+			LatencyMs:      latency.Milliseconds(),
+		})
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to log prompt: %v\n", err)
+	}
+}
+
+// messageText returns the text of a message, with its tool calls or results, for the log.
+func messageText(m model.Message) string {
+	parts := []string{}
+	if m.Text != "" {
+		parts = append(parts, m.Text)
+	}
+	for _, call := range m.ToolCalls {
+		args, _ := json.Marshal(call.Args)
+		parts = append(parts, fmt.Sprintf("[tool call %s %s]", call.Name, args))
+	}
+	for _, result := range m.ToolResults {
+		parts = append(parts, fmt.Sprintf("[tool result %s]\n%s", result.Name, result.Content))
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/ghchinoy/gen/internal/mcp"
+	"github.com/ghchinoy/gen/internal/model"
+	"github.com/ghchinoy/gen/internal/tools"
+)
+
+var mcpServerNames []string
+
+func init() {
+	rootCmd.AddCommand(mcpCmd)
+	mcpCmd.AddCommand(mcpListCmd)
+}
+
+var mcpCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "Use the tools of MCP servers",
+	Long: `MCP servers are listed in the mcpServers section of gen.yaml, and run over stdio:
+
+  mcpServers:
+    files:
+      command: npx
+      args: [-y, "@modelcontextprotocol/server-filesystem", "."]
+      env:
+        LOG_LEVEL: error
+
+Use --mcp <server> with gen prompt or gen interactive to let Gemini and Claude models call the server's tools.`,
+}
+
+var mcpListCmd = &cobra.Command{
+	Use:     "list [servers]",
+	Aliases: []string{"ls"},
+	Short:   "List the MCP servers in gen.yaml and their tools",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		servers, err := mcpServers()
+		if err != nil {
+			return err
+		}
+		names := args
+		if len(names) == 0 {
+			for name := range servers {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("no MCP servers in the mcpServers section of gen.yaml")
+		}
+
+		clients, available, err := connectMCP(context.Background(), names)
+		defer closeMCP(clients)
+		if err != nil {
+			return err
+		}
+		if Outputtype == "json" {
+			declarations := map[string][]model.Tool{}
+			for _, t := range available {
+				server := t.(mcpTool).server
+				declarations[server] = append(declarations[server], t.Declaration())
+			}
+			jsonBytes, err := json.Marshal(declarations)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(jsonBytes))
+			return nil
+		}
+		data := [][]string{}
+		for _, t := range available {
+			d := t.Declaration()
+			data = append(data, []string{t.(mcpTool).server, d.Name, d.Description})
+		}
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Server", "Tool", "Description"})
+		table.SetBorder(false)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.AppendBulk(data)
+		table.Render()
+		return nil
+	},
+}
+
+// mcpServer is an MCP server in gen.yaml, run as a local command.
+type mcpServer struct {
+	Command string            `yaml:"command"`
+	Args    []string          `yaml:"args"`
+	Env     map[string]string `yaml:"env"`
+}
+
+// mcpServers returns the MCP servers in the mcpServers section of gen.yaml.
+func mcpServers() (map[string]mcpServer, error) {
+	if viper.ConfigFileUsed() == "" {
+		return nil, fmt.Errorf("no gen.yaml to read the MCP servers from")
+	}
+	config, err := loadGenYAML()
+	if err != nil {
+		return nil, err
+	}
+	return config.MCPServers, nil
+}
+
+// connectMCP starts the named MCP servers and returns their tools.
+// The clients started are returned even on error, to be closed.
+func connectMCP(ctx context.Context, names []string) ([]*mcp.Client, []tools.Tool, error) {
+	if len(names) == 0 {
+		return nil, nil, nil
+	}
+	servers, err := mcpServers()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// servers log to stderr, which is only shown with --log
+	var stderr io.Writer = io.Discard
+	if Logtype != "none" {
+		stderr = os.Stderr
+	}
+	var clients []*mcp.Client
+	var available []tools.Tool
+	for _, name := range names {
+		server, ok := servers[name]
+		if !ok {
+			return clients, nil, fmt.Errorf("MCP server %s isn't in the mcpServers section of %s", name, viper.ConfigFileUsed())
+		}
+		client, err := mcp.Start(ctx, name, server.Command, server.Args, server.Env, mcp.Implementation{Name: "gen", Version: strings.TrimSpace(version)}, stderr)
+		if err != nil {
+			return clients, nil, err
+		}
+		clients = append(clients, client)
+		serverTools, err := client.ListTools(ctx)
+		if err != nil {
+			return clients, nil, err
+		}
+		for _, t := range serverTools {
+			available = append(available, mcpTool{server: name, client: client, tool: t})
+		}
+	}
+	return clients, available, nil
+}
+
+// closeMCP ends the sessions with the MCP servers.
+func closeMCP(clients []*mcp.Client) {
+	for _, c := range clients {
+		c.Close()
+	}
+}
+
+// mcpTool is a tool of an MCP server, called by the model.
+type mcpTool struct {
+	server string
+	client *mcp.Client
+	tool   mcp.Tool
+}
+
+// Declaration returns the MCP tool as declared to the model.
+func (t mcpTool) Declaration() model.Tool {
+	return model.Tool{Name: t.tool.Name, Description: t.tool.Description, Parameters: model.Schema(t.tool.InputSchema)}
+}
+
+// Run calls the tool on its MCP server.
+func (t mcpTool) Run(ctx context.Context, args map[string]interface{}) (string, error) {
+	result, err := t.client.CallTool(ctx, t.tool.Name, args)
+	if err != nil {
+		return "", err
+	}
+	if result.IsError {
+		return "", errors.New(result.Text())
+	}
+	return result.Text(), nil
+}
@@ -4,61 +4,142 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"strings"
+	"time"
 
+	"github.com/ghchinoy/gen/internal/index"
 	"github.com/ghchinoy/gen/internal/model"
+	"github.com/ghchinoy/gen/internal/templates"
 	"github.com/spf13/cobra"
 )
 
 var (
 	systemInstructions string
+	systemFile         string
+	schemaFile         string
+	attachFiles        []string
 )
 
 func init() {
 	rootCmd.AddCommand(promptCmd)
 
-	promptCmd.PersistentFlags().StringVarP(&modelName, "model", "m", "gemini-2.5-flash", "model name")
-promptCmd.Flag("model").DefValue = "gemini-2.5-flash"
-	//promptCmd.PersistentFlags().StringArrayVarP(&modelNames, "model", "m", []string{"gemini-1.5-flash"}, "model name(s)")
+	promptCmd.PersistentFlags().StringVarP(&modelName, "model", "m", defaultModelName, "model name or alias, defaults to the defaultModel of gen.yaml")
 	promptCmd.PersistentFlags().StringVarP(&modelConfigFile, "config", "c", "", "model parameters")
 	promptCmd.PersistentFlags().StringVarP(&promptFile, "file", "f", "", "prompt from file")
+	promptCmd.PersistentFlags().BoolVar(&noStdin, "no-stdin", false, "don't add input piped to gen to the prompt")
+	promptCmd.PersistentFlags().StringVarP(&systemInstructions, "system", "s", "", "system instructions")
+	promptCmd.PersistentFlags().StringVar(&systemFile, "system-file", "", "system instructions from file")
+	promptCmd.PersistentFlags().StringVar(&schemaFile, "schema", "", "JSON Schema the output must conform to")
+	promptCmd.PersistentFlags().BoolVar(&showUsage, "usage", false, "print token usage and estimated cost")
+	promptCmd.PersistentFlags().StringArrayVarP(&attachFiles, "attach", "a", nil, "attach a file (image, PDF, audio, video, text), repeatable")
+	promptCmd.PersistentFlags().BoolVar(&continueLast, "continue", false, "continue the last conversation")
+	promptCmd.PersistentFlags().StringVar(&conversationID, "conversation", "", "continue the conversation with this id")
+	promptCmd.PersistentFlags().StringVar(&ragSource, "rag", "", "answer from the documents in a directory or file, or an index file, citing them")
+	promptCmd.PersistentFlags().IntVar(&ragTopK, "rag-top", 5, "number of chunks to retrieve with --rag")
+	promptCmd.PersistentFlags().StringArrayVar(&toolFiles, "tools", nil, "YAML or JSON file of tools the model can call, repeatable")
+	promptCmd.PersistentFlags().StringArrayVar(&toolNames, "tool", nil, "a tool defined in gen.yaml the model can call, repeatable")
+	promptCmd.PersistentFlags().StringArrayVar(&mcpServerNames, "mcp", nil, "an MCP server in gen.yaml whose tools the model can call, repeatable")
+	promptCmd.PersistentFlags().BoolVarP(&approveAll, "yes", "y", false, "run tool calls without asking for confirmation")
+	promptCmd.PersistentFlags().StringVarP(&templateName, "template", "t", "", "run a prompt template, see gen templates")
+	promptCmd.PersistentFlags().StringArrayVarP(&templateParams, "param", "p", nil, "a template variable as key=value, repeatable")
 }
 
 var promptCmd = &cobra.Command{
 	Use:     "prompt",
 	Aliases: []string{"p"},
 	Short:   "Prompt a model",
-	Long:    `Provide prompt parts to a model to generate content`,
-	RunE:    generateContentE,
+	Long: `Provide prompt parts to a model to generate content.
+Input piped to gen is added to the prompt, or is the prompt when no other is given:
+
+  cat log.txt | gen p "summarize this"
+
+Use --no-stdin when stdin isn't meant for gen, as in a while read loop.`,
+	RunE: generateContentE,
 }
 
 // generateContentE prompts a model to generate content based on the provided prompt.
 func generateContentE(cmd *cobra.Command, args []string) error {
-	if !cmd.Flag("model").Changed {
-		modelName = "gemini-2.5-flash"
+	if err := selectModel(cmd); err != nil {
+		return err
+	}
+
+	prompt, err := promptInput(args)
+	if err != nil {
+		return err
+	}
+	if prompt == "" && templateName == "" {
+		return fmt.Errorf("please provide prompt")
+	}
+
+	// a template's model, system instructions and parameters apply unless given as flags
+	var tmpl templates.Template
+	if templateName != "" {
+		var system string
+		tmpl, prompt, system, err = loadTemplate(prompt)
+		if err != nil {
+			return err
+		}
+		if err := applyTemplate(tmpl, system, cmd.Flag("model").Changed); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := newConfig()
+	if err != nil {
+		return err
 	}
 
-	var prompt string
+	// the template's model is chosen for this prompt, so it applies to a resumed conversation too
+	saved, err := resumeConversation(cmd, tmpl.Model != "")
+	if err != nil {
+		return err
+	}
+	if err := applyModelDefaults(&cfg, modelName, &saved.Conversation); err != nil {
+		return err
+	}
+	if err := applyTemplateParameters(tmpl, &cfg); err != nil {
+		return err
+	}
+
+	attachments, err := loadAttachments(modelName, attachFiles)
+	if err != nil {
+		return err
+	}
+
+	if schemaFile != "" {
+		cfg.ModelParameters.ResponseSchema, err = model.LoadSchema(schemaFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+
+	runner, stopTools, err := startTools(ctx)
+	defer stopTools()
+	if err != nil {
+		return err
+	}
+	if runner != nil && schemaFile != "" {
+		return fmt.Errorf("use either --schema or tools, not both")
+	}
 
-	if promptFile != "" {
-		promptBytes, err := os.ReadFile(promptFile)
+	var sources []index.Result
+	if ragSource != "" {
+		ix, err := ragIndex(ctx, cfg, ragSource)
 		if err != nil {
-			return fmt.Errorf("unable to read file %s: %w", promptFile, err)
+			return err
 		}
-		prompt = string(promptBytes)
-	} else {
-		if len(args) == 0 {
-			return fmt.Errorf("please provide prompt")
+		sources, err = searchIndex(ctx, cfg, ix, prompt, ragTopK)
+		if err != nil {
+			return err
 		}
-		prompt = strings.Join(args, " ")
+		prompt = ragPrompt(prompt, sources)
 	}
 
-	cfg := model.Config{
-		ProjectID:  projectID,
-		RegionID:   region,
-		ConfigFile: cfgFile,
-		OutputType: Outputtype,
-		LogType:    Logtype,
+	conv := &saved.Conversation
+	conv.AddUser(prompt, attachments...)
+	if err := checkContextWindow(modelName, conv); err != nil {
+		return err
 	}
 
 	if Logtype != "none" {
@@ -66,13 +147,69 @@ func generateContentE(cmd *cobra.Command, args []string) error {
 		fmt.Printf("prompt: %s\n", prompt)
 	}
 
-	ctx := context.Background()
-
 	client, err := model.NewClient(ctx, cfg, modelName)
 	if err != nil {
 		return fmt.Errorf("error creating client: %w", err)
 	}
 
-	return client.GenerateContent(ctx, os.Stdout, prompt, nil)
+	usage, err := generateWithTools(ctx, client, os.Stdout, conv, cfg.ModelParameters, runner, func(latency time.Duration) {
+		logExchange(saved.ID, modelName, cfg.ModelParameters, conv, latency)
+	})
+	if err != nil {
+		return err
+	}
+	saveConversation(saved)
+
+	// sources are written to stderr, like usage
+	if len(sources) > 0 {
+		fmt.Fprintln(os.Stderr)
+		printSources(os.Stderr, sources)
+	}
+
+	// usage is written to stderr, to keep stdout to the model's output
+	if showUsage && usage != nil {
+		fmt.Fprintln(os.Stderr)
+		printUsage(os.Stderr, "usage", modelName, *usage)
+	}
+
+	// validate the structured output locally, as not every model family enforces the schema
+	if schema := cfg.ModelParameters.ResponseSchema; schema != nil {
+		fmt.Println()
+		if err := schema.Validate(conv.Messages[len(conv.Messages)-1].Text); err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+	}
+	return nil
 }
 
+// loadAttachments reads the attached files, refusing media the model can't accept.
+func loadAttachments(modelName string, paths []string) ([]model.Attachment, error) {
+	attachments := make([]model.Attachment, 0, len(paths))
+	for _, path := range paths {
+		attachment, err := model.LoadAttachment(path)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	if err := model.CheckAttachments(modelName, attachments); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// readSystemInstructions returns the system instructions given with --system or --system-file.
+func readSystemInstructions() (string, error) {
+	if systemFile == "" {
+		return systemInstructions, nil
+	}
+	if systemInstructions != "" {
+		return "", fmt.Errorf("use either --system or --system-file, not both")
+	}
+	data, err := os.ReadFile(systemFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to read file %s: %w", systemFile, err)
+	}
+	return string(data), nil
+}
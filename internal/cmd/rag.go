@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghchinoy/gen/internal/history"
+	"github.com/ghchinoy/gen/internal/index"
+	"github.com/ghchinoy/gen/internal/model"
+)
+
+var (
+	ragSource string
+	ragTopK   int
+)
+
+// ragIndex opens the index to retrieve from: an index file, or a cached index of a directory
+// or document, brought up to date with its files.
+func ragIndex(ctx context.Context, cfg model.Config, source string) (*index.Index, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() && index.IsFile(source) {
+		ix, err := index.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		if len(ix.Chunks) == 0 {
+			return nil, fmt.Errorf("index %s is empty, add documents to it with gen index add --index %s", source, source)
+		}
+		return ix, nil
+	}
+
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := history.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	// each directory or document has its own index, so unchanged files aren't embedded again
+	sum := sha256.Sum256([]byte(abs))
+	ix, err := index.Open(filepath.Join(dir, "indexes", hex.EncodeToString(sum[:8])+index.Ext))
+	if err != nil {
+		return nil, err
+	}
+	if ix.Model == "" {
+		ix.Model = "text-embedding-005"
+	}
+
+	var w io.Writer = io.Discard
+	if Logtype != "none" {
+		w = os.Stderr
+	}
+	if err := updateIndex(ctx, cfg, ix, []string{source}, w); err != nil {
+		return nil, err
+	}
+	if len(ix.Chunks) == 0 {
+		return nil, fmt.Errorf("no text files to answer from in %s; hidden, binary and files over 1MB are skipped", source)
+	}
+	return ix, nil
+}
+
+// ragPrompt adds the retrieved chunks to a prompt as numbered sources for the model to cite.
+// The sources are part of the prompt's text, so any model can be grounded the same way.
+func ragPrompt(prompt string, results []index.Result) string {
+	var b strings.Builder
+	b.WriteString("Answer the question using the numbered sources below. ")
+	b.WriteString("Cite the sources you use by their number, such as [1] or [2][3]. ")
+	b.WriteString("If the sources don't contain the answer, say so.\n\n")
+	for i, r := range results {
+		fmt.Fprintf(&b, "[%d] %s:%d-%d\n%s\n\n", i+1, displayPath(r.Source), r.StartLine, r.EndLine, strings.TrimRight(r.Text, "\n"))
+	}
+	fmt.Fprintf(&b, "Question: %s", prompt)
+	return b.String()
+}
+
+// printSources writes the numbered sources given to the model.
+func printSources(w io.Writer, results []index.Result) {
+	fmt.Fprintln(w, "sources:")
+	for i, r := range results {
+		fmt.Fprintf(w, "[%d] %s:%d-%d (%.3f)\n", i+1, displayPath(r.Source), r.StartLine, r.EndLine, r.Score)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 
+	"github.com/ghchinoy/gen/internal/model"
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -25,8 +26,9 @@ func init() {
 	rootCmd.MarkPersistentFlagRequired("project")
 	rootCmd.PersistentFlags().StringVar(&region, "region", "", "region for generative AI endpoint")
 	rootCmd.MarkPersistentFlagRequired("region")
-	rootCmd.PersistentFlags().StringVar(&Outputtype, "output", "text", "output type")
+	rootCmd.PersistentFlags().StringVar(&Outputtype, "output", "text", "output type, text or json")
 	rootCmd.PersistentFlags().StringVar(&Logtype, "log", "none", "logging output")
+	rootCmd.PersistentFlags().BoolVar(&noLog, "no-log", false, "don't record prompts and responses in the local log")
 }
 
 func initConfig() {
@@ -76,3 +78,15 @@ func initConfig() {
 		log.Println("Using config file:", viper.ConfigFileUsed())
 	}
 }
+
+// newConfig builds the model client configuration from the global flags and the model parameters file.
+func newConfig() (model.Config, error) {
+	builder := &model.ConfigBuilder{}
+	return builder.
+		ProjectID(projectID).
+		RegionID(region).
+		ConfigFile(modelConfigFile).
+		LogType(Logtype).
+		OutputType(Outputtype).
+		Build()
+}
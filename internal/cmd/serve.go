@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ghchinoy/gen/internal/history"
+	"github.com/ghchinoy/gen/internal/mcp"
+	"github.com/ghchinoy/gen/internal/model"
+	"github.com/ghchinoy/gen/internal/openai"
+)
+
+var (
+	servePort int
+	serveHost string
+)
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.AddCommand(serveMCPCmd)
+	serveCmd.Flags().IntVar(&servePort, "port", 8080, "port to listen on")
+	serveCmd.Flags().StringVar(&serveHost, "host", "localhost", "host to listen on; use 0.0.0.0 for all interfaces")
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the models of your project to other tools",
+	Long: `Serves an OpenAI compatible api, so tools built for OpenAI can use the Gemini, Claude, Llama and PaLM models of your project:
+
+  POST /v1/chat/completions  chat completions, streamed as server-sent events with "stream": true
+  POST /v1/embeddings        embeddings with a Gemini or Vertex AI text embedding model
+  GET  /v1/models            the models of gen's catalog
+
+For example, with the OpenAI SDKs, set the base URL to http://localhost:8080/v1 and use any api key.
+Use gen serve mcp to serve gen's tools to MCP clients instead.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := newConfig()
+		if err != nil {
+			return err
+		}
+		settings, err := loadModelSettings()
+		if err != nil {
+			return err
+		}
+		server := openai.NewServer(cfg)
+		defer server.Close()
+		server.Aliases = settings.Aliases
+		server.Defaults = func(modelName string) (model.GenerationParameters, string, error) {
+			modelCfg := cfg
+			conv := &model.Conversation{}
+			err := applyModelDefaults(&modelCfg, modelName, conv)
+			return modelCfg.ModelParameters, conv.System, err
+		}
+		server.OnReply = func(modelName string, params model.GenerationParameters, conv *model.Conversation, latency time.Duration) {
+			logExchange(history.NewID(), modelName, params, conv, latency)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		httpServer := &http.Server{
+			Addr:    net.JoinHostPort(serveHost, fmt.Sprint(servePort)),
+			Handler: server.Handler(),
+		}
+		// the clients are closed once the requests in flight are done
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			<-ctx.Done()
+			shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			httpServer.Shutdown(shutdown)
+		}()
+		log.Printf("serving on http://%s/v1", httpServer.Addr)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("unable to serve: %w", err)
+		}
+		<-stopped
+		return nil
+	},
+}
+
+var serveMCPCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "Serve gen's tools as an MCP server over stdio",
+	Long: `Runs an MCP server on stdin and stdout, offering the generate, count_tokens, embed and list_models tools,
+so editors and agents can use the models of your project with gen's configuration and credentials.
+For example, in an MCP client's configuration:
+
+  "gen": {"command": "gen", "args": ["serve", "mcp", "--project", "my-project", "--region", "us-central1"]}`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := newConfig()
+		if err != nil {
+			return err
+		}
+		// stdout carries the protocol, so the model output is always collected as text
+		cfg.OutputType = "text"
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		server := mcp.NewServer(mcp.Implementation{Name: "gen", Version: strings.TrimSpace(version)})
+		// a client is created once for each model called, for the session
+		clients := model.NewClients(cfg)
+		defer clients.Close()
+		addServerTools(server, cfg, clients)
+		return server.Serve(ctx, os.Stdin, os.Stdout)
+	},
+}
+
+// addServerTools offers gen's generate, count_tokens, embed and list_models tools, calling the models with the clients.
+func addServerTools(server *mcp.Server, cfg model.Config, clients *model.Clients) {
+	server.AddTool(mcp.Tool{
+		Name:        "generate",
+		Description: "Generate a response to a prompt with a Gemini, Claude, Llama or PaLM model on Vertex AI.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"prompt": map[string]interface{}{"type": "string", "description": "the prompt"},
+				"model":  map[string]interface{}{"type": "string", "description": "model name or alias, gen's default model by default; see list_models"},
+				"system": map[string]interface{}{"type": "string", "description": "system instructions"},
+				"parameters": map[string]interface{}{
+					"type":        "object",
+					"description": "model parameters, such as temperature, topP, topK, maxOutputTokens and stopSequences",
+				},
+			},
+			"required": []interface{}{"prompt"},
+		},
+	}, func(ctx context.Context, args map[string]interface{}) (string, error) {
+		var in struct {
+			Prompt     string                      `json:"prompt"`
+			Model      string                      `json:"model"`
+			System     string                      `json:"system"`
+			Parameters *model.GenerationParameters `json:"parameters"`
+		}
+		if err := decodeArgs(args, &in); err != nil {
+			return "", err
+		}
+		if in.Prompt == "" {
+			return "", fmt.Errorf("missing prompt")
+		}
+		var err error
+		in.Model, err = modelOrDefault(in.Model)
+		if err != nil {
+			return "", err
+		}
+		// the model's defaults in gen.yaml apply unless the call gives its own
+		conv := &model.Conversation{System: in.System}
+		defaults := cfg
+		if err := applyModelDefaults(&defaults, in.Model, conv); err != nil {
+			return "", err
+		}
+		params := defaults.ModelParameters
+		if in.Parameters != nil {
+			params = *in.Parameters
+		}
+
+		client, err := clients.Client(ctx, in.Model)
+		if err != nil {
+			return "", fmt.Errorf("error creating client: %w", err)
+		}
+		conv.AddUser(in.Prompt)
+		var output strings.Builder
+		start := time.Now()
+		if err := client.GenerateChat(ctx, &output, conv, params); err != nil {
+			return "", err
+		}
+		logExchange(history.NewID(), in.Model, params, conv, time.Since(start))
+		return conv.Messages[len(conv.Messages)-1].Text, nil
+	})
+
+	server.AddTool(mcp.Tool{
+		Name:        "count_tokens",
+		Description: "Count the tokens of a text with a model's tokenizer.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"text":  map[string]interface{}{"type": "string"},
+				"model": map[string]interface{}{"type": "string", "description": "model name or alias, gen's default model by default"},
+			},
+			"required": []interface{}{"text"},
+		},
+	}, func(ctx context.Context, args map[string]interface{}) (string, error) {
+		var in struct {
+			Text  string `json:"text"`
+			Model string `json:"model"`
+		}
+		if err := decodeArgs(args, &in); err != nil {
+			return "", err
+		}
+		var err error
+		in.Model, err = modelOrDefault(in.Model)
+		if err != nil {
+			return "", err
+		}
+		client, err := clients.Client(ctx, in.Model)
+		if err != nil {
+			return "", fmt.Errorf("error creating client: %w", err)
+		}
+		count, err := client.CountTokens(ctx, model.NewConversation(in.Text))
+		if err != nil {
+			return "", err
+		}
+		return marshalResult(count)
+	})
+
+	server.AddTool(mcp.Tool{
+		Name:        "embed",
+		Description: "Embed texts with a Gemini or Vertex AI text embedding model, returning a vector for each text.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"texts":      map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+				"model":      map[string]interface{}{"type": "string", "description": "embedding model name, text-embedding-005 by default"},
+				"taskType":   map[string]interface{}{"type": "string", "description": "such as RETRIEVAL_DOCUMENT, RETRIEVAL_QUERY or SEMANTIC_SIMILARITY"},
+				"dimensions": map[string]interface{}{"type": "integer", "description": "output dimensionality, for models that support it"},
+			},
+			"required": []interface{}{"texts"},
+		},
+	}, func(ctx context.Context, args map[string]interface{}) (string, error) {
+		var in struct {
+			Texts      []string `json:"texts"`
+			Model      string   `json:"model"`
+			TaskType   string   `json:"taskType"`
+			Dimensions int32    `json:"dimensions"`
+		}
+		if err := decodeArgs(args, &in); err != nil {
+			return "", err
+		}
+		if len(in.Texts) == 0 {
+			return "", fmt.Errorf("missing texts")
+		}
+		if in.Model == "" {
+			in.Model = "text-embedding-005"
+		}
+		client, err := clients.Embedder(ctx, in.Model)
+		if err != nil {
+			return "", fmt.Errorf("error creating client: %w", err)
+		}
+		embeddings, err := client.Embed(ctx, in.Texts, model.EmbedOptions{TaskType: in.TaskType, Dimensionality: in.Dimensions})
+		if err != nil {
+			return "", err
+		}
+		return marshalResult(embeddings)
+	})
+
+	server.AddTool(mcp.Tool{
+		Name:        "list_models",
+		Description: "List the models gen can use, with their family and mode.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"family": map[string]interface{}{"type": "string", "description": "only the models of this family, such as gemini or anthropic"},
+			},
+		},
+	}, func(ctx context.Context, args map[string]interface{}) (string, error) {
+		var in struct {
+			Family string `json:"family"`
+		}
+		if err := decodeArgs(args, &in); err != nil {
+			return "", err
+		}
+		models, err := model.List()
+		if err != nil {
+			return "", err
+		}
+		matching := []model.Model{}
+		for _, m := range models {
+			if in.Family == "" || m.Family == in.Family {
+				matching = append(matching, m)
+			}
+		}
+		return marshalResult(matching)
+	})
+}
+
+// decodeArgs reads a tool call's arguments into a struct.
+func decodeArgs(args map[string]interface{}, v interface{}) error {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+// marshalResult returns a tool's result as JSON text.
+func marshalResult(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ghchinoy/gen/internal/model"
+	"github.com/ghchinoy/gen/internal/tools"
+)
+
+// defaultModelName is the model used when neither --model nor the defaultModel of gen.yaml is set.
+const defaultModelName = "gemini-2.5-flash"
+
+// modelSettings are the model aliases and defaults in gen.yaml:
+//
+//	defaultModel: fast
+//	aliases:
+//	  fast: gemini-2.5-flash
+//	  smart: claude-3-7-sonnet@20250219
+//	models:
+//	  claude-3-7-sonnet:
+//	    system: Answer concisely.
+//	    parameters:
+//	      temperature: 0.2
+//	      maxOutputTokens: 4096
+//
+// The defaults of a model are matched by the longest model name prefix, so versioned models share them.
+type modelSettings struct {
+	DefaultModel string                   `yaml:"defaultModel"`
+	Aliases      map[string]string        `yaml:"aliases"`
+	Models       map[string]modelDefaults `yaml:"models"`
+}
+
+// modelDefaults are the system instructions and parameters a model is prompted with, unless given as flags.
+type modelDefaults struct {
+	System     string                 `yaml:"system"`
+	Parameters map[string]interface{} `yaml:"parameters"`
+}
+
+// genYAML is the part of gen.yaml gen reads itself, as is,
+// since viper lowercases keys such as model names, schema properties and environment variables.
+type genYAML struct {
+	modelSettings `yaml:",inline"`
+	Tools         []tools.Definition   `yaml:"tools"`
+	MCPServers    map[string]mcpServer `yaml:"mcpServers"`
+}
+
+// loadGenYAML returns the settings of gen.yaml, or empty settings when there's none.
+// gen.yaml is read once, on first use after the config file is found, for every command and server request.
+var loadGenYAML = sync.OnceValues(readGenYAML)
+
+// readGenYAML reads gen.yaml.
+func readGenYAML() (genYAML, error) {
+	var config genYAML
+	if viper.ConfigFileUsed() == "" {
+		return config, nil
+	}
+	data, err := os.ReadFile(viper.ConfigFileUsed())
+	if err != nil {
+		// a --config file that doesn't exist has no settings, as viper ignores it too
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return config, err
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("error reading %s: %w", viper.ConfigFileUsed(), err)
+	}
+	return config, nil
+}
+
+// loadModelSettings reads the model settings of gen.yaml.
+func loadModelSettings() (modelSettings, error) {
+	config, err := loadGenYAML()
+	return config.modelSettings, err
+}
+
+// resolveModel returns the model an alias of gen.yaml stands for, or the name itself.
+func resolveModel(name string) (string, error) {
+	settings, err := loadModelSettings()
+	if err != nil {
+		return "", err
+	}
+	return settings.resolve(name), nil
+}
+
+func (s modelSettings) resolve(name string) string {
+	if target, ok := s.Aliases[name]; ok {
+		return target
+	}
+	return name
+}
+
+// modelOrDefault resolves a model name or alias, or returns the default model for an empty name:
+// the defaultModel of gen.yaml, or gemini-2.5-flash.
+func modelOrDefault(name string) (string, error) {
+	settings, err := loadModelSettings()
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		name = settings.DefaultModel
+	}
+	if name == "" {
+		return defaultModelName, nil
+	}
+	return settings.resolve(name), nil
+}
+
+// selectModel sets the model of a command from --model, or the default model when it isn't given,
+// resolving aliases. The model flag is shared by every command, so its value must always be set.
+func selectModel(cmd *cobra.Command) error {
+	if !cmd.Flag("model").Changed {
+		modelName = ""
+	}
+	var err error
+	modelName, err = modelOrDefault(modelName)
+	return err
+}
+
+// defaultsFor returns the defaults of a model in gen.yaml.
+func defaultsFor(modelName string) (modelDefaults, error) {
+	settings, err := loadModelSettings()
+	if err != nil {
+		return modelDefaults{}, err
+	}
+	var prefix string
+	var found modelDefaults
+	for name, defaults := range settings.Models {
+		if strings.HasPrefix(modelName, name) && len(name) > len(prefix) {
+			prefix, found = name, defaults
+		}
+	}
+	return found, nil
+}
+
+// applyModelDefaults sets the model's default parameters, unless --config is given,
+// and its default system instructions for a new conversation without any.
+func applyModelDefaults(cfg *model.Config, modelName string, conv *model.Conversation) error {
+	defaults, err := defaultsFor(modelName)
+	if err != nil {
+		return err
+	}
+	if len(defaults.Parameters) > 0 && modelConfigFile == "" {
+		data, err := json.Marshal(defaults.Parameters)
+		if err != nil {
+			return err
+		}
+		cfg.ModelParameters, err = model.ParseGenerationParameters(data)
+		if err != nil {
+			return fmt.Errorf("error reading the parameters of %s in %s: %w", modelName, viper.ConfigFileUsed(), err)
+		}
+	}
+	if conv != nil && conv.System == "" && len(conv.Messages) == 0 {
+		conv.System = defaults.System
+	}
+	return nil
+}
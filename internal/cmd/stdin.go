@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ghchinoy/gen/internal/model"
+)
+
+// noStdin leaves stdin unread, when it's piped to gen but isn't part of the prompt.
+var noStdin bool
+
+// maxStdinBytes is the most gen reads from stdin, well above the largest context window.
+const maxStdinBytes = 32 << 20
+
+// stdinPiped reports whether stdin is a pipe or a file, rather than a terminal or /dev/null.
+func stdinPiped() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeNamedPipe != 0 || info.Mode().IsRegular()
+}
+
+// readStdin returns the content piped to gen, or "" when nothing is piped.
+func readStdin() (string, error) {
+	if !stdinPiped() {
+		return "", nil
+	}
+	data, err := io.ReadAll(io.LimitReader(os.Stdin, maxStdinBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("unable to read stdin: %w", err)
+	}
+	if len(data) > maxStdinBytes {
+		return "", fmt.Errorf("input from stdin is larger than %d MiB", maxStdinBytes>>20)
+	}
+	return string(data), nil
+}
+
+// promptInput returns the prompt given as arguments, or with --file, with the input piped to gen appended,
+// as in cat log.txt | gen p "summarize this". Piped input is the prompt when no other is given.
+// With --no-stdin, stdin is left alone, for scripts such as while read l; do gen p --no-stdin "$l"; done < file.
+func promptInput(args []string) (string, error) {
+	prompt := strings.Join(args, " ")
+	if promptFile != "" {
+		data, err := os.ReadFile(promptFile)
+		if err != nil {
+			return "", fmt.Errorf("unable to read file %s: %w", promptFile, err)
+		}
+		prompt = string(data)
+	}
+	if noStdin {
+		return prompt, nil
+	}
+	piped, err := readStdin()
+	if err != nil {
+		return "", err
+	}
+	return joinPrompt(prompt, piped), nil
+}
+
+// joinPrompt appends the piped input to the prompt, or returns it alone when there is no prompt.
+func joinPrompt(prompt, piped string) string {
+	piped = strings.TrimRight(piped, "\n")
+	switch {
+	case piped == "":
+		return prompt
+	case prompt == "":
+		return piped
+	default:
+		return prompt + "\n\n" + piped
+	}
+}
+
+// checkContextWindow refuses a conversation estimated to be larger than the model's context window,
+// before it's sent. Models without a known context window aren't checked.
+func checkContextWindow(modelName string, conv *model.Conversation) error {
+	window := model.ContextWindow(modelName)
+	if window == 0 {
+		return nil
+	}
+	if tokens := model.EstimateTokens(conv); tokens > window {
+		return fmt.Errorf("the prompt is about %d tokens, more than the %d token context window of %s", tokens, window, modelName)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPromptInput(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "prompt.txt")
+	if err := os.WriteFile(file, []byte("from the file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		file    string
+		piped   string
+		noStdin bool
+		want    string
+	}{
+		{name: "args only", args: []string{"summarize", "this"}, want: "summarize this"},
+		{name: "piped only", piped: "a log\n", want: "a log"},
+		{name: "args and piped", args: []string{"summarize this"}, piped: "a log\n", want: "summarize this\n\na log"},
+		{name: "file", args: []string{"ignored"}, file: file, want: "from the file"},
+		{name: "file and piped", file: file, piped: "a log", want: "from the file\n\na log"},
+		{name: "no stdin", args: []string{"summarize this"}, piped: "a log", noStdin: true, want: "summarize this"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a regular file is piped input; /dev/null isn't
+			stdin := os.DevNull
+			if tt.piped != "" {
+				stdin = filepath.Join(dir, "stdin")
+				if err := os.WriteFile(stdin, []byte(tt.piped), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			f, err := os.Open(stdin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			defer func(stdin *os.File) { os.Stdin = stdin }(os.Stdin)
+			os.Stdin = f
+			promptFile, noStdin = tt.file, tt.noStdin
+			defer func() { promptFile, noStdin = "", false }()
+
+			got, err := promptInput(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("prompt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ghchinoy/gen/internal/history"
+	"github.com/ghchinoy/gen/internal/model"
+	"github.com/ghchinoy/gen/internal/templates"
+)
+
+var (
+	templateName   string
+	templateParams []string
+)
+
+func init() {
+	rootCmd.AddCommand(templatesCmd)
+	templatesCmd.AddCommand(templatesListCmd)
+	templatesCmd.AddCommand(templatesShowCmd)
+	templatesCmd.AddCommand(templatesEditCmd)
+}
+
+var templatesCmd = &cobra.Command{
+	Use:     "templates",
+	Aliases: []string{"template"},
+	Short:   "Manage prompt templates",
+	Long: `Prompt templates are YAML files in $HOME/.config/gen/templates, named after the file.
+The prompt and system instructions are Go templates, rendered with the template's variables
+and those given with -p key=value; readFile reads a file:
+
+` + templates.Example + `
+Run a template with gen prompt -t <name> -p key=value; the prompt's arguments and piped input are the input variable.`,
+}
+
+var templatesListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List the prompt templates",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := templatesDir()
+		if err != nil {
+			return err
+		}
+		list, err := templates.List(dir)
+		if err != nil {
+			return err
+		}
+		if Outputtype == "json" {
+			jsonBytes, err := json.Marshal(list)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(jsonBytes))
+			return nil
+		}
+		if len(list) == 0 {
+			fmt.Printf("no templates in %s; create one with gen templates edit <name>\n", dir)
+			return nil
+		}
+		data := [][]string{}
+		for _, t := range list {
+			data = append(data, []string{t.Name, t.Model, t.Description})
+		}
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Name", "Model", "Description"})
+		table.SetBorder(false)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.AppendBulk(data)
+		table.Render()
+		return nil
+	},
+}
+
+var templatesShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Show a prompt template",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := templatesDir()
+		if err != nil {
+			return err
+		}
+		t, err := templates.Load(dir, args[0])
+		if err != nil {
+			return err
+		}
+		if Outputtype == "json" {
+			jsonBytes, err := json.Marshal(t)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(jsonBytes))
+			return nil
+		}
+		path, err := templates.Path(dir, t.Name)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+		return nil
+	},
+}
+
+var templatesEditCmd = &cobra.Command{
+	Use:   "edit <name>",
+	Short: "Edit a prompt template in $EDITOR, creating it if needed",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := templatesDir()
+		if err != nil {
+			return err
+		}
+		// the name is checked before anything is created, so it can't write outside the templates directory
+		path, err := templates.Path(dir, args[0])
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			if err := os.MkdirAll(dir, 0o700); err != nil {
+				return fmt.Errorf("unable to create templates directory %s: %w", dir, err)
+			}
+			if err := os.WriteFile(path, []byte(templates.Example), 0o600); err != nil {
+				return fmt.Errorf("unable to create template %s: %w", path, err)
+			}
+		}
+
+		editor := os.Getenv("VISUAL")
+		if editor == "" {
+			editor = os.Getenv("EDITOR")
+		}
+		if editor == "" {
+			editor = "vi"
+		}
+		// the editor may have arguments, such as "code --wait"
+		editorCmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+		editorCmd.Stdin, editorCmd.Stdout, editorCmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := editorCmd.Run(); err != nil {
+			return fmt.Errorf("error running editor %s: %w", editor, err)
+		}
+
+		// check the edited template, so mistakes show up now rather than when it's run
+		_, err = templates.Load(dir, args[0])
+		return err
+	},
+}
+
+// templatesDir returns the directory prompt templates are kept in.
+func templatesDir() (string, error) {
+	dir, err := history.DefaultDir()
+	if err != nil {
+		return "", err
+	}
+	return templates.Dir(dir), nil
+}
+
+// loadTemplate reads the template given with -t and renders it with the -p variables,
+// and the prompt's arguments and piped input, if any, as the input variable.
+func loadTemplate(input string) (templates.Template, string, string, error) {
+	dir, err := templatesDir()
+	if err != nil {
+		return templates.Template{}, "", "", err
+	}
+	t, err := templates.Load(dir, templateName)
+	if err != nil {
+		return templates.Template{}, "", "", err
+	}
+	vars, err := templates.ParseVars(templateParams)
+	if err != nil {
+		return templates.Template{}, "", "", err
+	}
+	if _, ok := vars["input"]; !ok && input != "" {
+		vars["input"] = input
+	}
+	prompt, system, err := t.Render(vars)
+	if err != nil {
+		return templates.Template{}, "", "", err
+	}
+	return t, prompt, system, nil
+}
+
+// applyTemplate sets the template's model and rendered system instructions, unless given as flags.
+func applyTemplate(t templates.Template, system string, modelChanged bool) error {
+	if t.Model != "" && !modelChanged {
+		var err error
+		modelName, err = resolveModel(t.Model)
+		if err != nil {
+			return err
+		}
+	}
+	if systemInstructions == "" && systemFile == "" {
+		systemInstructions = system
+	}
+	return nil
+}
+
+// applyTemplateParameters sets the template's parameters, over the model's defaults, unless --config is given.
+func applyTemplateParameters(t templates.Template, cfg *model.Config) error {
+	if len(t.Parameters) == 0 || modelConfigFile != "" {
+		return nil
+	}
+	var err error
+	cfg.ModelParameters, err = t.GenerationParameters()
+	return err
+}
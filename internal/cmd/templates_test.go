@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/ghchinoy/gen/internal/model"
+	"github.com/ghchinoy/gen/internal/templates"
+)
+
+func TestApplyTemplate(t *testing.T) {
+	tmpl := templates.Template{
+		Name:       "summarize",
+		Model:      "gemini-2.5-pro",
+		Parameters: map[string]interface{}{"temperature": 0.2},
+	}
+	flagTemperature := float32(1)
+
+	tests := []struct {
+		name            string
+		modelChanged    bool
+		system          string
+		systemFile      string
+		configFile      string
+		wantModel       string
+		wantSystem      string
+		wantTemperature float32
+	}{
+		{
+			name:            "template values",
+			wantModel:       "gemini-2.5-pro",
+			wantSystem:      "from the template",
+			wantTemperature: 0.2,
+		},
+		{
+			name:            "--model",
+			modelChanged:    true,
+			wantModel:       "gemini-2.5-flash",
+			wantSystem:      "from the template",
+			wantTemperature: 0.2,
+		},
+		{
+			name:            "--system",
+			system:          "from the flag",
+			wantModel:       "gemini-2.5-pro",
+			wantSystem:      "from the flag",
+			wantTemperature: 0.2,
+		},
+		{
+			name:            "--system-file",
+			systemFile:      "system.txt",
+			wantModel:       "gemini-2.5-pro",
+			wantTemperature: 0.2,
+		},
+		{
+			name:            "--config",
+			configFile:      "params.json",
+			wantModel:       "gemini-2.5-pro",
+			wantSystem:      "from the template",
+			wantTemperature: flagTemperature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelName, systemInstructions, systemFile, modelConfigFile = "gemini-2.5-flash", tt.system, tt.systemFile, tt.configFile
+			defer func() { modelName, systemInstructions, systemFile, modelConfigFile = "", "", "", "" }()
+			// the parameters of the --config file, when it's given
+			cfg := model.Config{ModelParameters: model.GenerationParameters{Temperature: &flagTemperature}}
+
+			if err := applyTemplate(tmpl, "from the template", tt.modelChanged); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyTemplateParameters(tmpl, &cfg); err != nil {
+				t.Fatal(err)
+			}
+			if modelName != tt.wantModel {
+				t.Errorf("model = %s, want %s", modelName, tt.wantModel)
+			}
+			if systemInstructions != tt.wantSystem {
+				t.Errorf("system = %q, want %q", systemInstructions, tt.wantSystem)
+			}
+			if got := cfg.ModelParameters.Temperature; got == nil || *got != tt.wantTemperature {
+				t.Errorf("temperature = %v, want %v", got, tt.wantTemperature)
+			}
+		})
+	}
+}
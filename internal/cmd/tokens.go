@@ -2,13 +2,12 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"os"
-	"strconv"
 
-	"cloud.google.com/go/vertexai/genai"
+	"github.com/ghchinoy/gen/internal/model"
 	"github.com/spf13/cobra"
 )
 
@@ -17,58 +16,75 @@ var promptFile string
 func init() {
 	rootCmd.AddCommand(tokensCmd)
 
-	tokensCmd.PersistentFlags().StringVarP(&modelName, "model", "m", "gemini-2.5-flash", "model name")
+	tokensCmd.PersistentFlags().StringVarP(&modelName, "model", "m", defaultModelName, "model name or alias, defaults to the defaultModel of gen.yaml")
 	tokensCmd.PersistentFlags().StringVarP(&promptFile, "file", "f", "", "prompt file")
+	tokensCmd.PersistentFlags().BoolVar(&noStdin, "no-stdin", false, "don't add input piped to gen to the prompt")
 }
 
 var tokensCmd = &cobra.Command{
 	Use:     "tokens",
 	Aliases: []string{"t", "count", "tokencount", "tc"},
 	Short:   "Count tokens for a prompt",
-	Long:    `Returns the count of tokens for a provided prompt`,
-	Run:     countTokensForPrompt,
+	Long: `Returns the count of tokens for a provided prompt, using the model's tokenizer.
+Models without a token counting api, such as Llama, use an estimate of four characters per token.
+Input piped to gen is added to the prompt, as in cat main.go | gen tokens.`,
+	RunE: countTokensForPrompt,
 }
 
 // countTokensForPrompt is the cobra implementation of countTokens
-func countTokensForPrompt(cmd *cobra.Command, args []string) {
-	var prompt string
-	if promptFile != "" { // read in file
-		promptBytes, err := os.ReadFile(promptFile)
-		if err != nil {
-			log.Fatal(err)
-		}
-		prompt = string(promptBytes)
-	} else {
-		if len(args) == 0 {
-			log.Fatal("requires a prompt to count tokens")
-		}
-		prompt = args[0]
+func countTokensForPrompt(cmd *cobra.Command, args []string) error {
+	if err := selectModel(cmd); err != nil {
+		return err
+	}
+
+	prompt, err := promptInput(args)
+	if err != nil {
+		return err
+	}
+	if prompt == "" {
+		return fmt.Errorf("requires a prompt to count tokens")
 	}
 
-	err := countTokens(os.Stdout, string(prompt), projectID, region, modelName)
+	cfg, err := newConfig()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+
+	return countTokens(os.Stdout, cfg, modelName, prompt)
 }
 
-// countTokens returns the number of tokens for this prompt.
-func countTokens(w io.Writer, prompt, projectID, location, modelName string) error {
+// countTokens writes the number of tokens for this prompt.
+func countTokens(w io.Writer, cfg model.Config, modelName, prompt string) error {
 	ctx := context.Background()
 
-	client, err := genai.NewClient(ctx, projectID, location)
+	client, err := model.NewClient(ctx, cfg, modelName)
 	if err != nil {
-		return fmt.Errorf("unable to create client: %v", err)
+		return fmt.Errorf("error creating client: %w", err)
 	}
-	defer client.Close()
-
-	model := client.GenerativeModel(modelName)
 
-	resp, err := model.CountTokens(ctx, genai.Text(prompt))
+	count, err := client.CountTokens(ctx, model.NewConversation(prompt))
 	if err != nil {
 		return err
 	}
 
-	fmt.Fprintf(w, "Number of tokens for the prompt: %s\n", strconv.FormatInt(int64(resp.TotalTokens), 10))
+	// the count is still reported, with a warning on stderr, when it's more than the model accepts
+	if window := model.ContextWindow(modelName); window > 0 && count.TotalTokens > window {
+		fmt.Fprintf(os.Stderr, "warning: %d tokens is more than the %d token context window of %s\n", count.TotalTokens, window, modelName)
+	}
+
+	if cfg.OutputType == "json" {
+		jsonBytes, err := json.Marshal(count)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(jsonBytes))
+		return nil
+	}
 
+	if count.Estimated {
+		fmt.Fprintf(w, "Estimated number of tokens for the prompt: %d\n", count.TotalTokens)
+	} else {
+		fmt.Fprintf(w, "Number of tokens for the prompt: %d\n", count.TotalTokens)
+	}
 	return nil
 }
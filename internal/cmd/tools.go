@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/ghchinoy/gen/internal/model"
+	"github.com/ghchinoy/gen/internal/tools"
+)
+
+var (
+	toolFiles  []string
+	toolNames  []string
+	approveAll bool
+)
+
+// maxToolRounds limits the model-tool loop, in case a model keeps calling tools.
+const maxToolRounds = 10
+
+// loadTools returns the tools in the --tools files, and the tools of gen.yaml named with --tool.
+func loadTools() ([]tools.Tool, error) {
+	var loaded []tools.Tool
+	for _, path := range toolFiles {
+		definitions, err := tools.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range definitions {
+			loaded = append(loaded, d)
+		}
+	}
+	if len(toolNames) == 0 {
+		return loaded, nil
+	}
+
+	if viper.ConfigFileUsed() == "" {
+		return nil, fmt.Errorf("no gen.yaml to read the tools %s from", strings.Join(toolNames, ", "))
+	}
+	config, err := loadGenYAML()
+	if err != nil {
+		return nil, err
+	}
+	definitions := config.Tools
+	for _, d := range definitions {
+		if err := d.Validate(); err != nil {
+			return nil, fmt.Errorf("error reading tools %s: %w", viper.ConfigFileUsed(), err)
+		}
+	}
+	for _, name := range toolNames {
+		found := false
+		for _, d := range definitions {
+			if d.Name == name {
+				loaded = append(loaded, d)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("tool %s isn't defined in %s", name, viper.ConfigFileUsed())
+		}
+	}
+	return loaded, nil
+}
+
+// startTools loads the tools given with --tools and --tool, and starts the MCP servers given with --mcp.
+// It returns a runner for the tools, nil when there are none, and a function stopping the MCP servers
+// and closing the runner.
+func startTools(ctx context.Context) (*toolRunner, func(), error) {
+	available, err := loadTools()
+	if err != nil {
+		return nil, func() {}, err
+	}
+	clients, serverTools, err := connectMCP(ctx, mcpServerNames)
+	stop := func() { closeMCP(clients) }
+	if err != nil {
+		return nil, stop, err
+	}
+	runner, err := newToolRunner(append(available, serverTools...))
+	return runner, func() {
+		runner.close()
+		closeMCP(clients)
+	}, err
+}
+
+// toolRunner runs the tools called by a model, asking the user to confirm each call.
+type toolRunner struct {
+	tools        map[string]tools.Tool
+	declarations []model.Tool
+	// approved skips the confirmation, after --yes or answering "a".
+	approved bool
+	// tty is the terminal the confirmations are read from, opened on the first call.
+	tty     *os.File
+	confirm *bufio.Reader
+}
+
+// newToolRunner returns a runner for the tools, or nil when there are none.
+func newToolRunner(available []tools.Tool) (*toolRunner, error) {
+	if len(available) == 0 {
+		return nil, nil
+	}
+	r := &toolRunner{tools: map[string]tools.Tool{}, approved: approveAll}
+	for _, t := range available {
+		name := t.Declaration().Name
+		if _, ok := r.tools[name]; ok {
+			return nil, fmt.Errorf("tool %s is defined more than once", name)
+		}
+		r.tools[name] = t
+		r.declarations = append(r.declarations, t.Declaration())
+	}
+	return r, nil
+}
+
+// close closes the terminal opened to confirm tool calls.
+func (r *toolRunner) close() {
+	if r != nil && r.tty != nil {
+		r.tty.Close()
+	}
+}
+
+// run runs a tool call once the user confirms it. Tool errors and declined calls are returned
+// to the model as error results; an error is returned only when the call can't be confirmed.
+func (r *toolRunner) run(ctx context.Context, call model.ToolCall) (model.ToolResult, error) {
+	result := model.ToolResult{ID: call.ID, Name: call.Name}
+	args := []byte("{}")
+	if len(call.Args) > 0 {
+		args, _ = json.Marshal(call.Args)
+	}
+	fmt.Fprintf(os.Stderr, "tool call: %s %s\n", call.Name, args)
+
+	t, ok := r.tools[call.Name]
+	if !ok {
+		result.Content, result.IsError = fmt.Sprintf("unknown tool %s", call.Name), true
+		return result, nil
+	}
+	ok, err := r.allowed()
+	if err != nil {
+		return result, err
+	}
+	if !ok {
+		result.Content, result.IsError = "the user declined to run the tool", true
+		return result, nil
+	}
+
+	output, err := t.Run(ctx, call.Args)
+	if err != nil {
+		result.Content, result.IsError = err.Error(), true
+		fmt.Fprintf(os.Stderr, "tool error: %v\n", err)
+		return result, nil
+	}
+	result.Content = output
+	return result, nil
+}
+
+// allowed asks the user to confirm a tool call on the terminal, so it works when stdin is piped.
+func (r *toolRunner) allowed() (bool, error) {
+	if r.approved {
+		return true, nil
+	}
+	if r.confirm == nil {
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			return false, fmt.Errorf("no terminal to confirm tool calls; use --yes to run them without confirmation")
+		}
+		r.tty, r.confirm = tty, bufio.NewReader(tty)
+	}
+	fmt.Fprint(os.Stderr, "run it? [y]es, [n]o, [a]ll: ")
+	answer, err := r.confirm.ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	case "a", "all":
+		r.approved = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// generateWithTools generates the next turn of a conversation, running the tools the model calls
+// and sending their results back until the model answers. afterReply is called after each reply,
+// and the usage of all the replies is returned.
+func generateWithTools(ctx context.Context, client model.ModelClient, w io.Writer, conv *model.Conversation, params model.GenerationParameters,
+	runner *toolRunner, afterReply func(latency time.Duration)) (*model.Usage, error) {
+	if runner != nil {
+		params.Tools = runner.declarations
+	}
+
+	var total *model.Usage
+	for round := 0; ; round++ {
+		start := time.Now()
+		if err := client.GenerateChat(ctx, w, conv, params); err != nil {
+			return total, err
+		}
+		afterReply(time.Since(start))
+		if usage := conv.LastUsage(); usage != nil {
+			sum := *usage
+			if total != nil {
+				sum = total.Add(sum)
+			}
+			total = &sum
+		}
+
+		calls := conv.PendingToolCalls()
+		if len(calls) == 0 || runner == nil {
+			return total, nil
+		}
+		if round == maxToolRounds {
+			return total, fmt.Errorf("stopped after %d rounds of tool calls", maxToolRounds)
+		}
+		if conv.Messages[len(conv.Messages)-1].Text != "" {
+			fmt.Fprintln(w)
+		}
+		results := make([]model.ToolResult, 0, len(calls))
+		for _, call := range calls {
+			result, err := runner.run(ctx, call)
+			if err != nil {
+				return total, err
+			}
+			results = append(results, result)
+		}
+		conv.AddToolResults(results...)
+	}
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ghchinoy/gen/internal/model"
+	"github.com/spf13/viper"
+)
+
+var showUsage bool
+
+// pricingOverrides returns the model prices set in the pricing section of gen.yaml, such as:
+//
+//	pricing:
+//	  - model: gemini-2.5-flash
+//	    input: 0.30
+//	    output: 2.50
+//	    cachedInput: 0.075
+func pricingOverrides() []model.Price {
+	var prices []model.Price
+	if err := viper.UnmarshalKey("pricing", &prices); err != nil {
+		return nil
+	}
+	return prices
+}
+
+// printUsage writes the token usage and its estimated cost.
+func printUsage(w io.Writer, label, modelName string, usage model.Usage) {
+	cost := "unknown"
+	if price, err := model.GetPrice(modelName, pricingOverrides()); err == nil {
+		cost = fmt.Sprintf("$%.6f", price.Cost(usage))
+	}
+	fmt.Fprintf(w, "%s: input tokens: %d, output tokens: %d, cached tokens: %d, estimated cost: %s\n",
+		label, usage.InputTokens, usage.OutputTokens, usage.CachedTokens, cost)
+}
@@ -0,0 +1,141 @@
+// Package gcs reads and writes Cloud Storage objects with the Cloud Storage JSON api.
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+)
+
+// Client is an authenticated Cloud Storage JSON api client.
+type Client struct {
+	httpClient *http.Client
+	endpoint   string
+}
+
+// NewClient creates a Cloud Storage client with the application default credentials.
+func NewClient(ctx context.Context) (*Client, error) {
+	httpClient, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/devstorage.read_write")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create authenticated http client: %v", err)
+	}
+	return &Client{httpClient: httpClient, endpoint: "https://storage.googleapis.com"}, nil
+}
+
+// ParseURI splits a gs://bucket/object URI into its bucket and object name.
+func ParseURI(uri string) (bucket, object string, err error) {
+	path, ok := strings.CutPrefix(uri, "gs://")
+	if !ok {
+		return "", "", fmt.Errorf("%s is not a Cloud Storage URI, gs://bucket/path", uri)
+	}
+	bucket, object, _ = strings.Cut(path, "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("%s is missing a bucket name", uri)
+	}
+	return bucket, object, nil
+}
+
+// Upload writes an object.
+func (c *Client) Upload(ctx context.Context, uri string, data []byte, contentType string) error {
+	bucket, object, err := ParseURI(uri)
+	if err != nil {
+		return err
+	}
+	if object == "" {
+		return fmt.Errorf("%s is missing an object name", uri)
+	}
+	u := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s", c.endpoint, url.PathEscape(bucket), url.QueryEscape(object))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("unable to upload %s: %w", uri, err)
+	}
+	return resp.Body.Close()
+}
+
+// Download reads an object.
+func (c *Client) Download(ctx context.Context, uri string) (io.ReadCloser, error) {
+	bucket, object, err := ParseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", c.endpoint, url.PathEscape(bucket), url.PathEscape(object))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to download %s: %w", uri, err)
+	}
+	return resp.Body, nil
+}
+
+// List returns the URIs of the objects starting with a prefix, such as gs://bucket/path/.
+func (c *Client) List(ctx context.Context, prefix string) ([]string, error) {
+	bucket, object, err := ParseURI(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var uris []string
+	pageToken := ""
+	for {
+		query := url.Values{"prefix": {object}, "fields": {"items(name),nextPageToken"}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		u := fmt.Sprintf("%s/storage/v1/b/%s/o?%s", c.endpoint, url.PathEscape(bucket), query.Encode())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %v", err)
+		}
+		resp, err := c.do(req)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list %s: %w", prefix, err)
+		}
+		var page struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading object list: %v", err)
+		}
+		for _, item := range page.Items {
+			uris = append(uris, fmt.Sprintf("gs://%s/%s", bucket, item.Name))
+		}
+		if page.NextPageToken == "" {
+			return uris, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// do sends a request, returning an error for an unsuccessful response.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return resp, nil
+}
@@ -0,0 +1,183 @@
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeStorage is a Cloud Storage JSON api serving objects from memory, one object per page of a list.
+type fakeStorage struct {
+	mu      sync.Mutex
+	objects map[string]string // bucket/name to content
+	types   map[string]string // bucket/name to content type
+}
+
+func (f *fakeStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fail := func(status int, message string) {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"error":{"code":%d,"message":%q}}`, status, message)
+	}
+
+	path := r.URL.EscapedPath()
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/upload/storage/v1/b/"):
+		bucket := strings.TrimSuffix(strings.TrimPrefix(path, "/upload/storage/v1/b/"), "/o")
+		if r.URL.Query().Get("uploadType") != "media" {
+			fail(http.StatusBadRequest, "unsupported upload type")
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		key := bucket + "/" + r.URL.Query().Get("name")
+		f.objects[key] = string(data)
+		f.types[key] = r.Header.Get("Content-Type")
+		fmt.Fprintf(w, `{"name":%q}`, r.URL.Query().Get("name"))
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/storage/v1/b/"):
+		rest := strings.TrimPrefix(r.URL.Path, "/storage/v1/b/")
+		bucket, object, _ := strings.Cut(rest, "/o")
+		if bucket == "forbidden" {
+			fail(http.StatusForbidden, "caller does not have storage.objects.get access")
+			return
+		}
+		if object == "" {
+			f.list(w, r, bucket)
+			return
+		}
+		content, ok := f.objects[bucket+"/"+strings.TrimPrefix(object, "/")]
+		if !ok || r.URL.Query().Get("alt") != "media" {
+			fail(http.StatusNotFound, "No such object")
+			return
+		}
+		io.WriteString(w, content)
+	default:
+		fail(http.StatusMethodNotAllowed, "unexpected request "+r.Method+" "+path)
+	}
+}
+
+// list returns one object of a bucket with the prefix per page, the page token being the index of the next.
+func (f *fakeStorage) list(w http.ResponseWriter, r *http.Request, bucket string) {
+	var names []string
+	for key := range f.objects {
+		if name, ok := strings.CutPrefix(key, bucket+"/"); ok && strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var page struct {
+		Items         []map[string]string `json:"items,omitempty"`
+		NextPageToken string              `json:"nextPageToken,omitempty"`
+	}
+	i := 0
+	fmt.Sscan(r.URL.Query().Get("pageToken"), &i)
+	if i < len(names) {
+		page.Items = []map[string]string{{"name": names[i]}}
+	}
+	if i+1 < len(names) {
+		page.NextPageToken = fmt.Sprint(i + 1)
+	}
+	json.NewEncoder(w).Encode(page)
+}
+
+func newTestClient(t *testing.T) (*Client, *fakeStorage) {
+	t.Helper()
+	fake := &fakeStorage{objects: map[string]string{}, types: map[string]string{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return &Client{httpClient: server.Client(), endpoint: server.URL}, fake
+}
+
+func TestUploadDownload(t *testing.T) {
+	c, fake := newTestClient(t)
+	ctx := context.Background()
+
+	uri := "gs://my-bucket/batch/input file.jsonl"
+	if err := c.Upload(ctx, uri, []byte(`{"id":"a"}`), "application/jsonl"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.types["my-bucket/batch/input file.jsonl"]; got != "application/jsonl" {
+		t.Errorf("content type = %q, want application/jsonl", got)
+	}
+
+	r, err := c.Download(ctx, uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"id":"a"}` {
+		t.Errorf("downloaded %q, want the uploaded object", data)
+	}
+}
+
+func TestList(t *testing.T) {
+	c, fake := newTestClient(t)
+	fake.objects["my-bucket/out/predictions-1.jsonl"] = "1"
+	fake.objects["my-bucket/out/predictions-2.jsonl"] = "2"
+	fake.objects["my-bucket/out/predictions-3.jsonl"] = "3"
+	fake.objects["my-bucket/other.jsonl"] = "other"
+	fake.objects["other-bucket/out/predictions-1.jsonl"] = "other"
+
+	uris, err := c.List(context.Background(), "gs://my-bucket/out/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "gs://my-bucket/out/predictions-1.jsonl gs://my-bucket/out/predictions-2.jsonl gs://my-bucket/out/predictions-3.jsonl"
+	if got := strings.Join(uris, " "); got != want {
+		t.Errorf("uris = %s, want all three pages: %s", got, want)
+	}
+
+	uris, err = c.List(context.Background(), "gs://my-bucket/none/")
+	if err != nil || len(uris) != 0 {
+		t.Errorf("list = %v, %v, want no objects", uris, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		call    func() error
+		wantErr string
+	}{
+		{"missing object", func() error {
+			_, err := c.Download(ctx, "gs://my-bucket/missing.jsonl")
+			return err
+		}, `unable to download gs://my-bucket/missing.jsonl: 404 Not Found: {"error":{"code":404,"message":"No such object"}}`},
+		{"forbidden list", func() error {
+			_, err := c.List(ctx, "gs://forbidden/out/")
+			return err
+		}, "unable to list gs://forbidden/out/: 403 Forbidden: "},
+		{"not a Cloud Storage URI", func() error {
+			return c.Upload(ctx, "s3://my-bucket/a.jsonl", nil, "application/jsonl")
+		}, "s3://my-bucket/a.jsonl is not a Cloud Storage URI, gs://bucket/path"},
+		{"missing object name", func() error {
+			return c.Upload(ctx, "gs://my-bucket", nil, "application/jsonl")
+		}, "gs://my-bucket is missing an object name"},
+		{"missing bucket", func() error {
+			_, err := c.List(ctx, "gs:///out/")
+			return err
+		}, "gs:///out/ is missing a bucket name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
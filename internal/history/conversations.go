@@ -0,0 +1,130 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ghchinoy/gen/internal/model"
+)
+
+// Conversation is a saved conversation, which can be resumed with any model.
+type Conversation struct {
+	ID      string    `json:"id"`
+	Model   string    `json:"model"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	model.Conversation
+}
+
+// conversationsDir returns the directory conversations are saved in, one JSON file per conversation.
+func (s *Store) conversationsDir() string {
+	return filepath.Join(s.dir, "conversations")
+}
+
+// SaveConversation writes a conversation, replacing any earlier version with the same id.
+func (s *Store) SaveConversation(c *Conversation) error {
+	if err := os.MkdirAll(s.conversationsDir(), 0o700); err != nil {
+		return fmt.Errorf("unable to create conversation directory: %w", err)
+	}
+	now := time.Now().UTC()
+	if c.Created.IsZero() {
+		c.Created = now
+	}
+	c.Updated = now
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling conversation: %w", err)
+	}
+	// write to a temporary file first, so an interrupted save keeps the previous version
+	path := filepath.Join(s.conversationsDir(), c.ID+".json")
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		return fmt.Errorf("unable to save conversation %s: %w", c.ID, err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Conversations returns every saved conversation, oldest first.
+func (s *Store) Conversations() ([]*Conversation, error) {
+	files, err := os.ReadDir(s.conversationsDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read conversations: %w", err)
+	}
+
+	var conversations []*Conversation
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		c, err := s.readConversation(filepath.Join(s.conversationsDir(), f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, c)
+	}
+	// files are read in name order, and ids sort by creation time
+	return conversations, nil
+}
+
+// GetConversation returns the conversation with an id, or the only conversation whose id starts with it.
+func (s *Store) GetConversation(id string) (*Conversation, error) {
+	path := filepath.Join(s.conversationsDir(), id+".json")
+	if _, err := os.Stat(path); err == nil {
+		return s.readConversation(path)
+	}
+
+	conversations, err := s.Conversations()
+	if err != nil {
+		return nil, err
+	}
+	var matches []*Conversation
+	for _, c := range conversations {
+		if strings.HasPrefix(c.ID, id) {
+			matches = append(matches, c)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("conversation %s not found", id)
+	case 1:
+		return matches[0], nil
+	}
+	return nil, fmt.Errorf("conversation %s is ambiguous, matching %d conversations", id, len(matches))
+}
+
+// LastConversation returns the most recently updated conversation.
+func (s *Store) LastConversation() (*Conversation, error) {
+	conversations, err := s.Conversations()
+	if err != nil {
+		return nil, err
+	}
+	var last *Conversation
+	for _, c := range conversations {
+		if last == nil || c.Updated.After(last.Updated) {
+			last = c
+		}
+	}
+	if last == nil {
+		return nil, fmt.Errorf("no saved conversations to continue")
+	}
+	return last, nil
+}
+
+func (s *Store) readConversation(path string) (*Conversation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read conversation %s: %w", path, err)
+	}
+	var c Conversation
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("error reading conversation %s: %w", path, err)
+	}
+	return &c, nil
+}
@@ -0,0 +1,162 @@
+// Package history keeps a local log of prompts and responses exchanged with models.
+package history
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ghchinoy/gen/internal/model"
+	"github.com/mitchellh/go-homedir"
+)
+
+// Entry is a single prompt and response exchanged with a model.
+type Entry struct {
+	ID             string                     `json:"id"`
+	ConversationID string                     `json:"conversationId,omitempty"`
+	Timestamp      time.Time                  `json:"timestamp"`
+	Model          string                     `json:"model"`
+	Parameters     model.GenerationParameters `json:"parameters"`
+	System         string                     `json:"system,omitempty"`
+	Prompt         string                     `json:"prompt"`
+	Attachments    []string                   `json:"attachments,omitempty"`
+	Response       string                     `json:"response"`
+	Usage          *model.Usage               `json:"usage,omitempty"`
+	LatencyMs      int64                      `json:"latencyMs"`
+}
+
+// NewID returns a new log identifier, which sorts by creation time.
+func NewID() string {
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// DefaultDir returns the directory gen keeps its local data in, $HOME/.config/gen.
+func DefaultDir() (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "gen"), nil
+}
+
+// Store is a log of entries kept as JSON lines in a local file,
+// alongside the saved conversations.
+type Store struct {
+	dir  string
+	path string
+}
+
+// Open opens the log in a directory, creating the directory if needed.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create log directory %s: %w", dir, err)
+	}
+	return &Store{dir: dir, path: filepath.Join(dir, "logs.jsonl")}, nil
+}
+
+// OpenDefault opens the log in the default directory.
+func OpenDefault() (*Store, error) {
+	dir, err := DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return Open(dir)
+}
+
+// Path returns the location of the log file.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Append adds an entry to the log.
+func (s *Store) Append(e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error marshalling log entry: %w", err)
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("unable to open log %s: %w", s.path, err)
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// List returns every entry in the log, oldest first.
+func (s *Store) List() ([]Entry, error) {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open log %s: %w", s.path, err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("error reading log %s: %w", s.path, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Get returns the entry with an id, or the only entry whose id starts with it.
+func (s *Store) Get(id string) (Entry, error) {
+	entries, err := s.List()
+	if err != nil {
+		return Entry{}, err
+	}
+	var matches []Entry
+	for _, e := range entries {
+		if e.ID == id {
+			return e, nil
+		}
+		if strings.HasPrefix(e.ID, id) {
+			matches = append(matches, e)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Entry{}, fmt.Errorf("log %s not found", id)
+	case 1:
+		return matches[0], nil
+	}
+	return Entry{}, fmt.Errorf("log %s is ambiguous, matching %d logs", id, len(matches))
+}
+
+// Search returns the entries whose model, system instructions, prompt or response contain the query, ignoring case.
+func (s *Store) Search(query string) ([]Entry, error) {
+	entries, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	query = strings.ToLower(query)
+	var found []Entry
+	for _, e := range entries {
+		for _, field := range []string{e.Model, e.System, e.Prompt, e.Response} {
+			if strings.Contains(strings.ToLower(field), query) {
+				found = append(found, e)
+				break
+			}
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,188 @@
+// Package index keeps a local vector store of embedded document chunks, searched by cosine similarity.
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Chunk is a part of a document and its embedding.
+type Chunk struct {
+	Source string `json:"source"`
+	// StartLine and EndLine are the chunk's first and last lines in the source, counting from 1.
+	StartLine int       `json:"startLine"`
+	EndLine   int       `json:"endLine"`
+	Text      string    `json:"text"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// Index is a vector store of chunks kept in a local JSON file.
+// Every chunk of an index is embedded with the same model.
+type Index struct {
+	Model string `json:"model"`
+	// Files are the SHA-256 hashes of the indexed sources, to skip unchanged files.
+	Files  map[string]string `json:"files"`
+	Chunks []Chunk           `json:"chunks"`
+	path   string
+}
+
+// Result is a chunk matching a search, with its cosine similarity to the query.
+type Result struct {
+	Chunk
+	Score float64 `json:"score"`
+}
+
+// Ext is the extension of index files, which tells them apart from JSON documents.
+const Ext = ".index.json"
+
+// IsFile reports whether a path is named as an index file.
+func IsFile(path string) bool {
+	return strings.HasSuffix(path, Ext)
+}
+
+// DefaultPath returns the location of the default index, in the given gen directory.
+func DefaultPath(dir string) string {
+	return filepath.Join(dir, "default"+Ext)
+}
+
+// Open reads an index file, or returns an empty index if the file doesn't exist yet.
+// Index files are named with the Ext extension.
+func Open(path string) (*Index, error) {
+	if !IsFile(path) {
+		return nil, fmt.Errorf("index files are named *%s, not %s", Ext, filepath.Base(path))
+	}
+	ix := &Index{Files: map[string]string{}, path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read index %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, ix); err != nil {
+		return nil, fmt.Errorf("error reading index %s: %w", path, err)
+	}
+	if ix.Files == nil {
+		ix.Files = map[string]string{}
+	}
+	return ix, nil
+}
+
+// Path returns the location of the index file.
+func (ix *Index) Path() string {
+	return ix.path
+}
+
+// Save writes the index file.
+func (ix *Index) Save() error {
+	if err := os.MkdirAll(filepath.Dir(ix.path), 0o700); err != nil {
+		return fmt.Errorf("unable to create index directory: %w", err)
+	}
+	data, err := json.Marshal(ix)
+	if err != nil {
+		return fmt.Errorf("error marshalling index: %w", err)
+	}
+	// write to a temporary file first, so an interrupted save keeps the previous index
+	if err := os.WriteFile(ix.path+".tmp", data, 0o600); err != nil {
+		return fmt.Errorf("unable to save index %s: %w", ix.path, err)
+	}
+	return os.Rename(ix.path+".tmp", ix.path)
+}
+
+// Hash returns the hash of a source's content, as kept in Files.
+func Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Add replaces the chunks of a source.
+func (ix *Index) Add(source, hash string, chunks []Chunk) {
+	ix.Remove(source)
+	ix.Files[source] = hash
+	ix.Chunks = append(ix.Chunks, chunks...)
+}
+
+// Remove drops the chunks of a source, returning the number of chunks removed.
+func (ix *Index) Remove(source string) int {
+	delete(ix.Files, source)
+	kept := ix.Chunks[:0]
+	for _, c := range ix.Chunks {
+		if c.Source != source {
+			kept = append(kept, c)
+		}
+	}
+	removed := len(ix.Chunks) - len(kept)
+	ix.Chunks = kept
+	return removed
+}
+
+// Search returns the k chunks most similar to the query embedding, most similar first.
+func (ix *Index) Search(query []float32, k int) []Result {
+	results := make([]Result, 0, len(ix.Chunks))
+	for _, c := range ix.Chunks {
+		results = append(results, Result{Chunk: c, Score: Cosine(query, c.Embedding)})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// Cosine returns the cosine similarity of two vectors, or 0 if their lengths differ or either is zero.
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// Split divides text into chunks of whole lines of about size characters,
+// each starting with about overlap characters of the previous chunk's last lines.
+// Lines longer than size are kept whole.
+func Split(source, text string, size, overlap int) []Chunk {
+	lines := strings.SplitAfter(strings.TrimSuffix(text, "\n"), "\n")
+	var chunks []Chunk
+	start := 0
+	for start < len(lines) {
+		end, length := start, 0
+		for end < len(lines) && (end == start || length+len(lines[end]) <= size) {
+			length += len(lines[end])
+			end++
+		}
+		chunk := strings.Join(lines[start:end], "")
+		if strings.TrimSpace(chunk) != "" {
+			chunks = append(chunks, Chunk{Source: source, StartLine: start + 1, EndLine: end, Text: chunk})
+		}
+		if end == len(lines) {
+			break
+		}
+
+		// step back over the overlapping lines, always moving forward
+		next, back := end, 0
+		for next-1 > start && back+len(lines[next-1]) <= overlap {
+			back += len(lines[next-1])
+			next--
+		}
+		start = next
+	}
+	return chunks
+}
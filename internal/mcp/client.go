@@ -0,0 +1,232 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Client is a session with an MCP server run as a local process, talking over its stdin and stdout.
+type Client struct {
+	name string
+	cmd  *exec.Cmd
+	in   io.WriteCloser
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan *Message
+	// done is closed when the server's output ends, with the reason in err.
+	done chan struct{}
+	err  error
+
+	// Server is the server's response to the initialize request.
+	Server InitializeResult
+}
+
+// Start runs an MCP server's command and initializes a session with it.
+// The server's stderr, where servers log, is written to stderr.
+func Start(ctx context.Context, name, command string, args []string, env map[string]string, client Implementation, stderr io.Writer) (*Client, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+os.ExpandEnv(v))
+	}
+	cmd.Stderr = stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("unable to start MCP server %s: %w", name, err)
+	}
+
+	c := &Client{
+		name:    name,
+		cmd:     cmd,
+		in:      in,
+		pending: map[int64]chan *Message{},
+		done:    make(chan struct{}),
+	}
+	go c.read(out)
+
+	params := InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]interface{}{},
+		ClientInfo:      client,
+	}
+	if err := c.call(ctx, "initialize", params, &c.Server); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("error initializing MCP server %s: %w", name, err)
+	}
+	if err := c.notify("notifications/initialized"); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("error initializing MCP server %s: %w", name, err)
+	}
+	return c, nil
+}
+
+// Name returns the name of the server, as configured.
+func (c *Client) Name() string {
+	return c.name
+}
+
+// ListTools returns the server's tools, reading every page.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	cursor := ""
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var page ListToolsResult
+		if err := c.call(ctx, "tools/list", params, &page); err != nil {
+			return nil, fmt.Errorf("error listing the tools of MCP server %s: %w", c.name, err)
+		}
+		tools = append(tools, page.Tools...)
+		if page.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CallTool calls one of the server's tools. A tool that fails reports it with IsError in the result.
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]interface{}) (CallToolResult, error) {
+	var result CallToolResult
+	if err := c.call(ctx, "tools/call", CallToolParams{Name: name, Arguments: args}, &result); err != nil {
+		return CallToolResult{}, fmt.Errorf("error calling %s on MCP server %s: %w", name, c.name, err)
+	}
+	return result, nil
+}
+
+// Close ends the session, closing the server's stdin and killing the server if it doesn't exit.
+func (c *Client) Close() error {
+	c.in.Close()
+	exited := make(chan error, 1)
+	go func() { exited <- c.cmd.Wait() }()
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(2 * time.Second):
+		c.cmd.Process.Kill()
+		return <-exited
+	}
+}
+
+// call sends a request and waits for its response, unmarshalling the result.
+func (c *Client) call(ctx context.Context, method string, params, result interface{}) error {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	response := make(chan *Message, 1)
+	c.pending[id] = response
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	if err := c.write(&Message{JSONRPC: "2.0", ID: json.RawMessage(strconv.FormatInt(id, 10)), Method: method, Params: data}); err != nil {
+		return err
+	}
+
+	select {
+	case m := <-response:
+		if m.Error != nil {
+			return m.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(m.Result, result)
+	case <-c.done:
+		return fmt.Errorf("server exited: %w", c.err)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// notify sends a notification.
+func (c *Client) notify(method string) error {
+	return c.write(&Message{JSONRPC: "2.0", Method: method})
+}
+
+// write sends a message as a line of JSON.
+func (c *Client) write(m *Message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.in.Write(append(data, '\n'))
+	return err
+}
+
+// read dispatches the server's responses to the pending calls, and answers its requests.
+func (c *Client) read(out io.Reader) {
+	r := bufio.NewReader(out)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			c.dispatch(line)
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			c.err = err
+			close(c.done)
+			return
+		}
+	}
+}
+
+// dispatch handles a message from the server.
+func (c *Client) dispatch(line []byte) {
+	var m Message
+	if err := json.Unmarshal(line, &m); err != nil {
+		// servers may print other lines, which aren't part of the protocol
+		return
+	}
+	switch {
+	case m.Method != "" && m.ID != nil:
+		// the server's requests, such as ping; gen offers no client capabilities
+		reply := &Message{JSONRPC: "2.0", ID: m.ID, Result: json.RawMessage("{}")}
+		if m.Method != "ping" {
+			reply = &Message{JSONRPC: "2.0", ID: m.ID, Error: &Error{Code: MethodNotFound, Message: "method not found: " + m.Method}}
+		}
+		c.write(reply)
+	case m.Method != "":
+		// notifications, such as logging, are ignored
+	default:
+		id, err := strconv.ParseInt(string(m.ID), 10, 64)
+		if err != nil {
+			return
+		}
+		c.mu.Lock()
+		response, ok := c.pending[id]
+		c.mu.Unlock()
+		if ok {
+			response <- &m
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubEnv runs the test binary as a stub MCP server, in the mode it's set to, rather than the tests.
+const stubEnv = "GEN_MCP_STUB"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(stubEnv); mode != "" {
+		runStub(mode, os.Stdin, os.Stdout)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runStub is a stub MCP server with two tools, echo and fail, over stdio.
+// Its output includes lines outside the protocol and a notification, which the client ignores.
+func runStub(mode string, r io.Reader, w io.Writer) {
+	in := bufio.NewScanner(r)
+	send := func(m Message) {
+		m.JSONRPC = "2.0"
+		data, _ := json.Marshal(m)
+		fmt.Fprintf(w, "%s\n", data)
+	}
+	reply := func(id json.RawMessage, result interface{}) {
+		data, _ := json.Marshal(result)
+		send(Message{ID: id, Result: data})
+	}
+	fail := func(id json.RawMessage, code int, message string) {
+		send(Message{ID: id, Error: &Error{Code: code, Message: message}})
+	}
+
+	fmt.Fprintln(w, "stub server starting")
+	initialized := false
+	for in.Scan() {
+		var m Message
+		if err := json.Unmarshal(in.Bytes(), &m); err != nil {
+			fail(nil, ParseError, err.Error())
+			continue
+		}
+		switch m.Method {
+		case "initialize":
+			if mode == "reject" {
+				fail(m.ID, InvalidRequest, "unsupported protocol version")
+				continue
+			}
+			var params InitializeParams
+			json.Unmarshal(m.Params, &params)
+			send(Message{Method: "notifications/message", Params: json.RawMessage(`{"level":"info","data":"hello"}`)})
+			reply(m.ID, InitializeResult{
+				ProtocolVersion: params.ProtocolVersion,
+				Capabilities:    map[string]interface{}{"tools": map[string]interface{}{}},
+				ServerInfo:      Implementation{Name: "stub for " + params.ClientInfo.Name, Version: "1.0"},
+			})
+		case "notifications/initialized":
+			initialized = true
+		case "tools/list":
+			if !initialized {
+				fail(m.ID, InvalidRequest, "not initialized")
+				continue
+			}
+			var params struct {
+				Cursor string `json:"cursor"`
+			}
+			json.Unmarshal(m.Params, &params)
+			// one tool per page
+			if params.Cursor == "" {
+				reply(m.ID, ListToolsResult{Tools: []Tool{{Name: "echo", InputSchema: map[string]interface{}{"type": "object"}}}, NextCursor: "2"})
+			} else {
+				reply(m.ID, ListToolsResult{Tools: []Tool{{Name: "fail", InputSchema: map[string]interface{}{"type": "object"}}}})
+			}
+		case "tools/call":
+			var params CallToolParams
+			json.Unmarshal(m.Params, &params)
+			switch params.Name {
+			case "echo":
+				// the client must answer the server's ping, and refuse requests it has no capability for
+				send(Message{ID: json.RawMessage(`"ping-1"`), Method: "ping"})
+				send(Message{ID: json.RawMessage(`"roots-1"`), Method: "roots/list"})
+				answers := map[string]Message{}
+				for len(answers) < 2 && in.Scan() {
+					var answer Message
+					json.Unmarshal(in.Bytes(), &answer)
+					answers[string(answer.ID)] = answer
+				}
+				ping, roots := answers[`"ping-1"`], answers[`"roots-1"`]
+				if ping.Error != nil || string(ping.Result) != "{}" || roots.Error == nil || roots.Error.Code != MethodNotFound {
+					fail(m.ID, InternalError, fmt.Sprintf("unexpected answers %s %s", ping.Result, roots.Result))
+					continue
+				}
+				reply(m.ID, CallToolResult{Content: []Content{{Type: "text", Text: fmt.Sprint(params.Arguments["text"])}}})
+			case "fail":
+				reply(m.ID, CallToolResult{Content: []Content{{Type: "text", Text: "boom"}}, IsError: true})
+			case "hang":
+				// never answers
+			case "crash":
+				os.Exit(3)
+			default:
+				fail(m.ID, InvalidParams, "unknown tool "+params.Name)
+			}
+		default:
+			if m.ID != nil {
+				fail(m.ID, MethodNotFound, "method not found: "+m.Method)
+			}
+		}
+	}
+}
+
+// startStub starts the test binary as a stub MCP server.
+func startStub(t *testing.T, mode string) (*Client, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return Start(ctx, "stub", os.Args[0], nil, map[string]string{stubEnv: mode}, Implementation{Name: "gen", Version: "test"}, io.Discard)
+}
+
+func TestClient(t *testing.T) {
+	c, err := startStub(t, "serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("initialize", func(t *testing.T) {
+		if c.Name() != "stub" {
+			t.Errorf("name = %s, want stub", c.Name())
+		}
+		want := InitializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    map[string]interface{}{"tools": map[string]interface{}{}},
+			ServerInfo:      Implementation{Name: "stub for gen", Version: "1.0"},
+		}
+		if !reflect.DeepEqual(c.Server, want) {
+			t.Errorf("server = %+v, want %+v", c.Server, want)
+		}
+	})
+
+	t.Run("tools/list", func(t *testing.T) {
+		tools, err := c.ListTools(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, tool := range tools {
+			names = append(names, tool.Name)
+		}
+		if strings.Join(names, ",") != "echo,fail" {
+			t.Errorf("tools = %v, want echo and fail from both pages", names)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		tool    string
+		args    map[string]interface{}
+		want    string
+		isError bool
+		wantErr string
+	}{
+		{name: "result", tool: "echo", args: map[string]interface{}{"text": "hi"}, want: "hi"},
+		{name: "tool error", tool: "fail", want: "boom", isError: true},
+		{name: "protocol error", tool: "missing", wantErr: "error calling missing on MCP server stub: unknown tool missing (-32602)"},
+	}
+	for _, tt := range tests {
+		t.Run("tools/call "+tt.name, func(t *testing.T) {
+			result, err := c.CallTool(ctx, tt.tool, tt.args)
+			if tt.wantErr != "" {
+				var rpcErr *Error
+				if !errors.As(err, &rpcErr) || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Text() != tt.want || result.IsError != tt.isError {
+				t.Errorf("result = %q, isError %v, want %q, %v", result.Text(), result.IsError, tt.want, tt.isError)
+			}
+		})
+	}
+
+	t.Run("tools/call timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		if _, err := c.CallTool(ctx, "hang", nil); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("error = %v, want the deadline exceeded", err)
+		}
+	})
+
+	t.Run("server exits", func(t *testing.T) {
+		_, err := c.CallTool(ctx, "crash", nil)
+		if err == nil || !strings.Contains(err.Error(), "server exited") {
+			t.Errorf("error = %v, want server exited", err)
+		}
+		if _, err := c.ListTools(ctx); err == nil {
+			t.Error("listed the tools of an exited server")
+		}
+	})
+}
+
+func TestStartErrors(t *testing.T) {
+	_, err := startStub(t, "reject")
+	if err == nil || !strings.Contains(err.Error(), "error initializing MCP server stub: unsupported protocol version") {
+		t.Errorf("error = %v, want the initialize error", err)
+	}
+
+	_, err = Start(context.Background(), "missing", "gen-no-such-mcp-server", nil, nil, Implementation{Name: "gen"}, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "unable to start MCP server missing") {
+		t.Errorf("error = %v, want unable to start", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	c, err := startStub(t, "serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the stub exits when its stdin is closed
+	if err := c.Close(); err != nil {
+		t.Errorf("close = %v, want a clean exit", err)
+	}
+}
@@ -0,0 +1,127 @@
+// Package mcp implements the Model Context Protocol's tools over stdio, as JSON-RPC 2.0 messages
+// written one per line.
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ProtocolVersion is the version of the Model Context Protocol gen speaks.
+const ProtocolVersion = "2025-06-18"
+
+// JSON-RPC error codes.
+const (
+	ParseError     = -32700
+	InvalidRequest = -32600
+	MethodNotFound = -32601
+	InvalidParams  = -32602
+	InternalError  = -32603
+)
+
+// Message is a JSON-RPC request, notification or response.
+// Requests have a method and an id, notifications a method only, and responses an id and a result or an error.
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is a JSON-RPC error.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+// Implementation names an MCP client or server.
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// InitializeParams are the parameters of the initialize request.
+type InitializeParams struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ClientInfo      Implementation         `json:"clientInfo"`
+}
+
+// InitializeResult is the server's response to the initialize request.
+type InitializeResult struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ServerInfo      Implementation         `json:"serverInfo"`
+	Instructions    string                 `json:"instructions,omitempty"`
+}
+
+// Tool is a tool offered by an MCP server.
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+// ListToolsResult is a page of the server's tools.
+type ListToolsResult struct {
+	Tools      []Tool `json:"tools"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// CallToolParams are the parameters of a tools/call request.
+type CallToolParams struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// CallToolResult is the output of a tool call.
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	// StructuredContent is the tool's output as a JSON object, for tools with an output schema.
+	StructuredContent map[string]interface{} `json:"structuredContent,omitempty"`
+	IsError           bool                   `json:"isError,omitempty"`
+}
+
+// Content is a part of a tool's output: text, an image, audio, or a resource.
+type Content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MIMEType string `json:"mimeType,omitempty"`
+	// Resource is an embedded resource, or the link of a resource_link.
+	Resource map[string]interface{} `json:"resource,omitempty"`
+	URI      string                 `json:"uri,omitempty"`
+}
+
+// Text returns the tool's output as text; non-text content is described by its type.
+func (r CallToolResult) Text() string {
+	parts := make([]string, 0, len(r.Content))
+	for _, c := range r.Content {
+		switch c.Type {
+		case "text":
+			parts = append(parts, c.Text)
+		case "resource":
+			if text, ok := c.Resource["text"].(string); ok {
+				parts = append(parts, text)
+			} else {
+				parts = append(parts, fmt.Sprintf("[resource %v]", c.Resource["uri"]))
+			}
+		case "resource_link":
+			parts = append(parts, fmt.Sprintf("[resource %s]", c.URI))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s %s]", c.Type, c.MIMEType))
+		}
+	}
+	if len(parts) == 0 && r.StructuredContent != nil {
+		data, _ := json.Marshal(r.StructuredContent)
+		return string(data)
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,147 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// supportedVersions are the protocol versions the server accepts from clients, newest first.
+var supportedVersions = []string{ProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// Handler runs a tool call with the client's arguments.
+// A returned error is reported to the client as a tool error, for the model to see.
+type Handler func(ctx context.Context, args map[string]interface{}) (string, error)
+
+// Server is an MCP server offering tools over stdio.
+type Server struct {
+	info     Implementation
+	tools    []Tool
+	handlers map[string]Handler
+
+	writeMu sync.Mutex
+	w       io.Writer
+}
+
+// NewServer returns a server without tools.
+func NewServer(info Implementation) *Server {
+	return &Server{info: info, handlers: map[string]Handler{}}
+}
+
+// AddTool offers a tool, handled by h.
+func (s *Server) AddTool(tool Tool, h Handler) {
+	s.tools = append(s.tools, tool)
+	s.handlers[tool.Name] = h
+}
+
+// Serve reads requests from r and writes responses to w until r ends or ctx is done.
+// Tool calls run concurrently, so a long generation doesn't hold up other requests.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.w = w
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var calls sync.WaitGroup
+	defer calls.Wait()
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			s.handle(ctx, line, &calls)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handle answers a message from the client.
+func (s *Server) handle(ctx context.Context, line []byte, calls *sync.WaitGroup) {
+	var m Message
+	if err := json.Unmarshal(line, &m); err != nil {
+		s.write(&Message{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: ParseError, Message: err.Error()}})
+		return
+	}
+	if m.ID == nil {
+		// notifications, such as notifications/initialized, need no answer
+		return
+	}
+
+	switch m.Method {
+	case "initialize":
+		var params InitializeParams
+		json.Unmarshal(m.Params, &params)
+		version := ProtocolVersion
+		for _, v := range supportedVersions {
+			if v == params.ProtocolVersion {
+				version = v
+			}
+		}
+		s.reply(m.ID, InitializeResult{
+			ProtocolVersion: version,
+			Capabilities:    map[string]interface{}{"tools": map[string]interface{}{}},
+			ServerInfo:      s.info,
+		})
+	case "ping":
+		s.reply(m.ID, struct{}{})
+	case "tools/list":
+		s.reply(m.ID, ListToolsResult{Tools: s.tools})
+	case "tools/call":
+		var params CallToolParams
+		if err := json.Unmarshal(m.Params, &params); err != nil {
+			s.fail(m.ID, InvalidParams, err.Error())
+			return
+		}
+		h, ok := s.handlers[params.Name]
+		if !ok {
+			s.fail(m.ID, InvalidParams, "unknown tool: "+params.Name)
+			return
+		}
+		calls.Add(1)
+		go func() {
+			defer calls.Done()
+			s.reply(m.ID, callResult(h(ctx, params.Arguments)))
+		}()
+	case "":
+		// a response, to a request the server never sends
+	default:
+		s.fail(m.ID, MethodNotFound, "method not found: "+m.Method)
+	}
+}
+
+// callResult returns a tool's output, or its error, as a tool result.
+func callResult(output string, err error) CallToolResult {
+	if err != nil {
+		return CallToolResult{Content: []Content{{Type: "text", Text: err.Error()}}, IsError: true}
+	}
+	return CallToolResult{Content: []Content{{Type: "text", Text: output}}}
+}
+
+// reply sends the result of a request.
+func (s *Server) reply(id json.RawMessage, result interface{}) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		s.fail(id, InternalError, fmt.Sprintf("error marshalling result: %v", err))
+		return
+	}
+	s.write(&Message{JSONRPC: "2.0", ID: id, Result: data})
+}
+
+// fail sends the error of a request.
+func (s *Server) fail(id json.RawMessage, code int, message string) {
+	s.write(&Message{JSONRPC: "2.0", ID: id, Error: &Error{Code: code, Message: message}})
+}
+
+// write sends a message as a line of JSON.
+func (s *Server) write(m *Message) {
+	data, _ := json.Marshal(m)
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.w.Write(append(data, '\n'))
+}
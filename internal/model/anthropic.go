@@ -2,56 +2,79 @@ package model
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"strings"
 
 	"cloud.google.com/go/aiplatform/apiv1"
 	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
 	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // AnthropicClient is a client for the Anthropic model.
 type AnthropicClient struct {
-	client *aiplatform.PredictionClient
-	cfg    Config
+	client    *aiplatform.PredictionClient
+	modelName string
+	cfg       Config
+}
+
+// NewAnthropicClient creates a new Anthropic client for a Claude model in the catalog.
+func NewAnthropicClient(client *aiplatform.PredictionClient, cfg Config, modelName string) (*AnthropicClient, error) {
+	m, err := Get(modelName)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s, see `gen models` for the Anthropic models", ErrUnknownModel, modelName)
+	}
+	if m.Family != "anthropic" {
+		return nil, fmt.Errorf("model %s is in the %s family, not anthropic", modelName, m.Family)
+	}
+	return &AnthropicClient{
+		client:    client,
+		modelName: modelName,
+		cfg:       cfg,
+	}, nil
+}
+
+// Close closes the connection to the api.
+func (c *AnthropicClient) Close() error {
+	return c.client.Close()
 }
 
 // GenerateContent generates content from the Anthropic model.
-func (c *AnthropicClient) GenerateContent(ctx context.Context, w io.Writer, prompt string, parameters map[string]interface{}) error {
+func (c *AnthropicClient) GenerateContent(ctx context.Context, w io.Writer, prompt string, params GenerationParameters) error {
+	return c.GenerateChat(ctx, w, NewConversation(prompt), params)
+}
+
+// GenerateChat generates the next turn of a conversation from the Anthropic model.
+func (c *AnthropicClient) GenerateChat(ctx context.Context, w io.Writer, conv *Conversation, params GenerationParameters) error {
 	// Endpoint
 	base := fmt.Sprintf("projects/%s/locations/%s/publishers/%s/models", c.cfg.ProjectID, c.cfg.RegionID, "anthropic")
-	url := fmt.Sprintf("%s/%s", base, "claude-3-sonnet@20240229")
+	url := fmt.Sprintf("%s/%s", base, c.modelName)
 	if c.cfg.LogType != "none" {
 		log.Printf("url: %s", url)
 	}
 
-	// Construct an Anthropic message.
-	claudeRequest := AnthropicRequest{
-		AnthropicVersion: "vertex-2023-10-16",
-		MaxTokens:        256,
-		Stream:           false,
-		Messages: []AnthropicMessage{
-			{
-				Content: []AnthropicContent{
-					{
-						Text: prompt,
-						Type: "text",
-					},
-				},
-				Role: "user",
-			},
-		},
+	claudeRequest, wrapped, err := anthropicRequest(conv, params)
+	if err != nil {
+		return err
 	}
+	claudeRequest.Stream = true
 
 	data, err := json.Marshal(&claudeRequest)
 	if err != nil {
 		return fmt.Errorf("error marshalling ClaudeRequest: %v", err)
 	}
+	data, err = mergeExtra(data, params.Extra)
+	if err != nil {
+		return fmt.Errorf("error adding model parameters: %v", err)
+	}
 
-	// using RawPredict
-	req := &aiplatformpb.RawPredictRequest{
+	// using StreamRawPredict, the response is a stream of server-sent events
+	req := &aiplatformpb.StreamRawPredictRequest{
 		Endpoint: url,
 		HttpBody: &httpbody.HttpBody{
 			ContentType: "application/json",
@@ -59,19 +82,274 @@ func (c *AnthropicClient) GenerateContent(ctx context.Context, w io.Writer, prom
 		},
 	}
 
-	resp, err := c.client.RawPredict(ctx, req)
+	stream, err := c.client.StreamRawPredict(ctx, req)
 	if err != nil {
-		return fmt.Errorf("error in prediction: %v", err)
+		return c.predictionError(err)
 	}
 
-	if c.cfg.OutputType == "json" {
-		fmt.Fprintln(w, string(resp.Data))
-	} else {
-		var r AnthropicResponse
-		_ = json.Unmarshal(resp.Data, &r)
-		fmt.Fprintf(w, "%v", r.Content[0].Text)
+	var reply, toolInput strings.Builder
+	var usage Usage
+	// the tool calls and their streamed inputs, by content block
+	var calls []ToolCall
+	var callInputs []*strings.Builder
+	callBlocks := map[int]int{}
+	err = readEvents(&rawPredictStreamReader{stream: stream}, func(event, data string) error {
+		if c.cfg.OutputType == "json" {
+			fmt.Fprintln(w, data)
+		}
+		var e AnthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			return fmt.Errorf("error unmarshalling AnthropicStreamEvent: %v", err)
+		}
+		switch e.Type {
+		case "message_start":
+			u := e.Message.Usage
+			usage.InputTokens = u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens
+			usage.CachedTokens = u.CacheReadInputTokens
+			usage.OutputTokens = u.OutputTokens
+		case "content_block_start":
+			if e.ContentBlock.Type == "tool_use" && params.ResponseSchema == nil {
+				callBlocks[e.Index] = len(calls)
+				calls = append(calls, ToolCall{ID: e.ContentBlock.ID, Name: e.ContentBlock.Name})
+				callInputs = append(callInputs, &strings.Builder{})
+			}
+		case "content_block_delta":
+			if i, ok := callBlocks[e.Index]; ok && e.Delta.Type == "input_json_delta" {
+				callInputs[i].WriteString(e.Delta.PartialJSON)
+				return nil
+			}
+			if e.Delta.Type == "input_json_delta" {
+				toolInput.WriteString(e.Delta.PartialJSON)
+				if !wrapped && c.cfg.OutputType != "json" {
+					fmt.Fprint(w, e.Delta.PartialJSON)
+				}
+				return nil
+			}
+			reply.WriteString(e.Delta.Text)
+			if c.cfg.OutputType != "json" {
+				fmt.Fprint(w, e.Delta.Text)
+			}
+		case "message_delta":
+			// the output token count is cumulative
+			usage.OutputTokens = e.Usage.OutputTokens
+			if c.cfg.LogType != "none" {
+				log.Printf("stop_reason: %s", e.Delta.StopReason)
+			}
+		case "error":
+			return &anthropicError{Type: e.Error.Type, Message: e.Error.Message}
+		}
+		return nil
+	})
+	if err != nil {
+		return c.predictionError(err)
+	}
 
+	if params.ResponseSchema != nil {
+		output := toolInput.String()
+		if wrapped {
+			var input struct {
+				Value json.RawMessage `json:"value"`
+			}
+			if err := json.Unmarshal([]byte(output), &input); err != nil {
+				return fmt.Errorf("error unmarshalling structured output: %v", err)
+			}
+			output = string(input.Value)
+			if c.cfg.OutputType != "json" {
+				fmt.Fprint(w, output)
+			}
+		}
+		conv.addReply(output, &usage)
+		return nil
 	}
+	if len(calls) > 0 {
+		for i, input := range callInputs {
+			if input.Len() == 0 {
+				continue
+			}
+			if err := json.Unmarshal([]byte(input.String()), &calls[i].Args); err != nil {
+				return fmt.Errorf("error unmarshalling %s tool input: %v", calls[i].Name, err)
+			}
+		}
+		conv.addToolReply(reply.String(), calls, &usage)
+		return nil
+	}
+	conv.addReply(reply.String(), &usage)
 
 	return nil
 }
+
+// structuredOutputTool is the name of the tool Claude is forced to call for structured output.
+const structuredOutputTool = "structured_output"
+
+// anthropicToolSchema returns the schema as a tool input schema, which must be an object;
+// other schemas are wrapped in an object with a single value property.
+func anthropicToolSchema(schema Schema) (Schema, bool) {
+	if schema["type"] == "object" {
+		return schema, false
+	}
+	return Schema{
+		"type":       "object",
+		"properties": map[string]interface{}{"value": map[string]interface{}(schema)},
+		"required":   []interface{}{"value"},
+	}, true
+}
+
+// anthropicMessages converts a conversation to Anthropic messages.
+func anthropicMessages(conv *Conversation) ([]AnthropicMessage, error) {
+	messages := make([]AnthropicMessage, 0, len(conv.Messages))
+	for _, m := range conv.Messages {
+		role := "user"
+		if m.Role == RoleModel {
+			role = "assistant"
+		}
+		var content []AnthropicContent
+		// text blocks can't be empty, but a message needs content
+		if m.Text != "" || (len(m.ToolCalls) == 0 && len(m.ToolResults) == 0) {
+			content = append(content, AnthropicContent{
+				Text: m.Text,
+				Type: "text",
+			})
+		}
+		for _, a := range m.Attachments {
+			block, err := anthropicContent(a)
+			if err != nil {
+				return nil, err
+			}
+			content = append(content, block)
+		}
+		for _, call := range m.ToolCalls {
+			input := json.RawMessage("{}")
+			if len(call.Args) > 0 {
+				input, _ = json.Marshal(call.Args)
+			}
+			content = append(content, AnthropicContent{Type: "tool_use", ID: call.ID, Name: call.Name, Input: input})
+		}
+		for _, result := range m.ToolResults {
+			content = append(content, AnthropicContent{Type: "tool_result", ToolUseID: result.ID, Content: result.Content, IsError: result.IsError})
+		}
+		messages = append(messages, AnthropicMessage{
+			Content: content,
+			Role:    role,
+		})
+	}
+	return messages, nil
+}
+
+// anthropicContent converts an attachment to an image, document or text content block.
+func anthropicContent(a Attachment) (AnthropicContent, error) {
+	if a.IsText() {
+		return AnthropicContent{Text: a.text(), Type: "text"}, nil
+	}
+	source := &AnthropicSource{
+		Type:      "base64",
+		MediaType: a.MIMEType,
+		Data:      base64.StdEncoding.EncodeToString(a.Data),
+	}
+	switch a.MIMEType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return AnthropicContent{Type: "image", Source: source}, nil
+	case "application/pdf":
+		return AnthropicContent{Type: "document", Source: source}, nil
+	}
+	return AnthropicContent{}, fmt.Errorf("attachment %s (%s) isn't supported by Claude models, which accept images and PDFs", a.Name, a.MIMEType)
+}
+
+// anthropicRequest builds the Anthropic message request for a conversation, and whether a
+// structured output schema was wrapped in an object to be used as the tool's input schema.
+func anthropicRequest(conv *Conversation, params GenerationParameters) (AnthropicRequest, bool, error) {
+	messages, err := anthropicMessages(conv)
+	if err != nil {
+		return AnthropicRequest{}, false, err
+	}
+
+	// Construct an Anthropic message.
+	claudeRequest := AnthropicRequest{
+		AnthropicVersion: "vertex-2023-10-16",
+		System:           conv.System,
+		MaxTokens:        params.maxOutputTokens(),
+		Temperature:      params.Temperature,
+		TopP:             params.TopP,
+		StopSequences:    params.StopSequences,
+		Messages:         messages,
+	}
+	if params.TopK != nil {
+		topK := int(*params.TopK)
+		claudeRequest.TopK = &topK
+	}
+	// structured output is emulated by forcing the model to call a tool whose input is the schema
+	var wrapped bool
+	if params.ResponseSchema != nil {
+		var inputSchema Schema
+		inputSchema, wrapped = anthropicToolSchema(params.ResponseSchema)
+		claudeRequest.Tools = []AnthropicTool{
+			{
+				Name:        structuredOutputTool,
+				Description: "Respond with output conforming to the input schema.",
+				InputSchema: inputSchema,
+			},
+		}
+		claudeRequest.ToolChoice = &AnthropicToolChoice{Type: "tool", Name: structuredOutputTool}
+	} else {
+		for _, t := range params.Tools {
+			inputSchema := t.Parameters
+			if inputSchema == nil {
+				inputSchema = Schema{"type": "object", "properties": map[string]interface{}{}}
+			}
+			claudeRequest.Tools = append(claudeRequest.Tools, AnthropicTool{
+				Name:        t.Name,
+				Description: t.Description,
+				InputSchema: inputSchema,
+			})
+		}
+	}
+	return claudeRequest, wrapped, nil
+}
+
+// predictionError explains prediction failures caused by a model that isn't enabled in the project's Model Garden.
+func (c *AnthropicClient) predictionError(err error) error {
+	switch status.Code(err) {
+	case codes.NotFound, codes.PermissionDenied, codes.FailedPrecondition:
+		publisherModel, _, _ := strings.Cut(c.modelName, "@")
+		return fmt.Errorf("model %s is not available in project %s (%s); enable it in Model Garden at https://console.cloud.google.com/vertex-ai/publishers/anthropic/model-garden/%s: %w",
+			c.modelName, c.cfg.ProjectID, c.cfg.RegionID, publisherModel, err)
+	}
+	return fmt.Errorf("error in prediction: %w", err)
+}
+
+// CountTokens counts the tokens in a conversation with Anthropic's count_tokens api.
+func (c *AnthropicClient) CountTokens(ctx context.Context, conv *Conversation) (TokenCount, error) {
+	url := fmt.Sprintf("projects/%s/locations/%s/publishers/anthropic/models/count-tokens", c.cfg.ProjectID, c.cfg.RegionID)
+	if c.cfg.LogType != "none" {
+		log.Printf("url: %s", url)
+	}
+
+	messages, err := anthropicMessages(conv)
+	if err != nil {
+		return TokenCount{}, err
+	}
+	data, err := json.Marshal(&AnthropicCountTokensRequest{
+		Model:    c.modelName,
+		System:   conv.System,
+		Messages: messages,
+	})
+	if err != nil {
+		return TokenCount{}, fmt.Errorf("error marshalling AnthropicCountTokensRequest: %v", err)
+	}
+
+	resp, err := c.client.RawPredict(ctx, &aiplatformpb.RawPredictRequest{
+		Endpoint: url,
+		HttpBody: &httpbody.HttpBody{
+			ContentType: "application/json",
+			Data:        data,
+		},
+	})
+	if err != nil {
+		return TokenCount{}, c.predictionError(err)
+	}
+
+	var r AnthropicCountTokensResponse
+	if err := json.Unmarshal(resp.Data, &r); err != nil {
+		return TokenCount{}, fmt.Errorf("error unmarshalling AnthropicCountTokensResponse: %v", err)
+	}
+	return TokenCount{Model: c.modelName, TotalTokens: r.InputTokens}, nil
+}
@@ -0,0 +1,111 @@
+package model
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Attachment is a file sent to the model alongside a prompt, such as an image, PDF, audio or video.
+type Attachment struct {
+	Name     string `json:"name"`
+	MIMEType string `json:"mimeType"`
+	Data     []byte `json:"data"`
+}
+
+// attachmentTypes are the MIME types of common attachment extensions, which may be missing from the system's MIME table.
+var attachmentTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".heic": "image/heic",
+	".pdf":  "application/pdf",
+	".mp3":  "audio/mpeg",
+	".wav":  "audio/wav",
+	".flac": "audio/flac",
+	".ogg":  "audio/ogg",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".mp4":  "video/mp4",
+	".mov":  "video/quicktime",
+	".webm": "video/webm",
+	".mpeg": "video/mpeg",
+	".txt":  "text/plain",
+	".md":   "text/markdown",
+	".csv":  "text/csv",
+	".json": "application/json",
+	".go":   "text/plain",
+	".py":   "text/plain",
+	".yaml": "text/plain",
+	".yml":  "text/plain",
+}
+
+// LoadAttachment reads a file and detects its MIME type from its extension, or its contents.
+func LoadAttachment(path string) (Attachment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("unable to read attachment %s: %w", path, err)
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	mimeType, ok := attachmentTypes[ext]
+	if !ok {
+		mimeType = mime.TypeByExtension(ext)
+	}
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+
+	return Attachment{
+		Name:     filepath.Base(path),
+		MIMEType: strings.TrimSpace(mimeType),
+		Data:     data,
+	}, nil
+}
+
+// IsText reports whether the attachment is text, which is sent to every model family as part of the prompt.
+func (a Attachment) IsText() bool {
+	return strings.HasPrefix(a.MIMEType, "text/") || a.MIMEType == "application/json"
+}
+
+// text returns a text attachment as a prompt part, labelled with its file name.
+func (a Attachment) text() string {
+	return fmt.Sprintf("%s:\n%s", a.Name, a.Data)
+}
+
+// CheckAttachments returns an error when the catalog lists the model as text-only and
+// the attachments include media other than text.
+func CheckAttachments(modelName string, attachments []Attachment) error {
+	m, err := Get(modelName)
+	if err != nil || m.Mode == "multimodal" {
+		return nil
+	}
+	for _, a := range attachments {
+		if !a.IsText() {
+			return fmt.Errorf("model %s is %s-only and can't accept %s (%s); use a multimodal model, see `gen models`", modelName, m.Mode, a.Name, a.MIMEType)
+		}
+	}
+	return nil
+}
+
+// textPrompt returns the message text with any text attachments appended,
+// for model families that only accept text.
+func (m Message) textPrompt() (string, error) {
+	if len(m.Attachments) == 0 {
+		return m.Text, nil
+	}
+	parts := []string{m.Text}
+	for _, a := range m.Attachments {
+		if !a.IsText() {
+			return "", fmt.Errorf("attachment %s (%s) isn't supported by this model family", a.Name, a.MIMEType)
+		}
+		parts = append(parts, a.text())
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
@@ -0,0 +1,378 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	aiplatform "cloud.google.com/go/aiplatform/apiv1"
+	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"google.golang.org/genai"
+)
+
+// BatchClient creates and tracks Vertex AI batch prediction jobs.
+type BatchClient struct {
+	client *aiplatform.JobClient
+	cfg    Config
+}
+
+// NewBatchClient creates a batch prediction client for the configured project and region.
+// Options are passed to the aiplatform JobClient, after the regional endpoint.
+func NewBatchClient(ctx context.Context, cfg Config, opts ...option.ClientOption) (*BatchClient, error) {
+	apiEndpoint := fmt.Sprintf("%s-aiplatform.googleapis.com:443", cfg.RegionID)
+	client, err := aiplatform.NewJobClient(ctx, append([]option.ClientOption{option.WithEndpoint(apiEndpoint)}, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create job client: %v", err)
+	}
+	return &BatchClient{client: client, cfg: cfg}, nil
+}
+
+// Close closes the connection to the api.
+func (c *BatchClient) Close() error {
+	return c.client.Close()
+}
+
+// jobName returns the resource name of a batch prediction job, given its name or id.
+func (c *BatchClient) jobName(id string) string {
+	if strings.HasPrefix(id, "projects/") {
+		return id
+	}
+	return fmt.Sprintf("projects/%s/locations/%s/batchPredictionJobs/%s", c.cfg.ProjectID, c.cfg.RegionID, id)
+}
+
+// Submit creates a batch prediction job reading JSON lines requests from inputURI and writing predictions under outputPrefix.
+func (c *BatchClient) Submit(ctx context.Context, displayName, modelName, inputURI, outputPrefix string) (*aiplatformpb.BatchPredictionJob, error) {
+	publisherModel, err := batchModel(modelName)
+	if err != nil {
+		return nil, err
+	}
+	job, err := c.client.CreateBatchPredictionJob(ctx, &aiplatformpb.CreateBatchPredictionJobRequest{
+		Parent: fmt.Sprintf("projects/%s/locations/%s", c.cfg.ProjectID, c.cfg.RegionID),
+		BatchPredictionJob: &aiplatformpb.BatchPredictionJob{
+			DisplayName: displayName,
+			Model:       publisherModel,
+			InputConfig: &aiplatformpb.BatchPredictionJob_InputConfig{
+				InstancesFormat: "jsonl",
+				Source: &aiplatformpb.BatchPredictionJob_InputConfig_GcsSource{
+					GcsSource: &aiplatformpb.GcsSource{Uris: []string{inputURI}},
+				},
+			},
+			OutputConfig: &aiplatformpb.BatchPredictionJob_OutputConfig{
+				PredictionsFormat: "jsonl",
+				Destination: &aiplatformpb.BatchPredictionJob_OutputConfig_GcsDestination{
+					GcsDestination: &aiplatformpb.GcsDestination{OutputUriPrefix: outputPrefix},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating batch prediction job: %w", err)
+	}
+	return job, nil
+}
+
+// Job returns a batch prediction job, given its name or id.
+func (c *BatchClient) Job(ctx context.Context, id string) (*aiplatformpb.BatchPredictionJob, error) {
+	job, err := c.client.GetBatchPredictionJob(ctx, &aiplatformpb.GetBatchPredictionJobRequest{Name: c.jobName(id)})
+	if err != nil {
+		return nil, fmt.Errorf("error getting batch prediction job %s: %w", id, err)
+	}
+	return job, nil
+}
+
+// Jobs returns up to limit of the project's batch prediction jobs, or all of them when limit is 0.
+func (c *BatchClient) Jobs(ctx context.Context, limit int) ([]*aiplatformpb.BatchPredictionJob, error) {
+	it := c.client.ListBatchPredictionJobs(ctx, &aiplatformpb.ListBatchPredictionJobsRequest{
+		Parent: fmt.Sprintf("projects/%s/locations/%s", c.cfg.ProjectID, c.cfg.RegionID),
+	})
+	var jobs []*aiplatformpb.BatchPredictionJob
+	for limit == 0 || len(jobs) < limit {
+		job, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error listing batch prediction jobs: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Cancel requests cancellation of a batch prediction job, given its name or id.
+func (c *BatchClient) Cancel(ctx context.Context, id string) error {
+	if err := c.client.CancelBatchPredictionJob(ctx, &aiplatformpb.CancelBatchPredictionJobRequest{Name: c.jobName(id)}); err != nil {
+		return fmt.Errorf("error cancelling batch prediction job %s: %w", id, err)
+	}
+	return nil
+}
+
+// JobDone reports whether a batch prediction job has finished, successfully or not.
+func JobDone(job *aiplatformpb.BatchPredictionJob) bool {
+	switch job.GetState() {
+	case aiplatformpb.JobState_JOB_STATE_SUCCEEDED,
+		aiplatformpb.JobState_JOB_STATE_PARTIALLY_SUCCEEDED,
+		aiplatformpb.JobState_JOB_STATE_FAILED,
+		aiplatformpb.JobState_JOB_STATE_CANCELLED,
+		aiplatformpb.JobState_JOB_STATE_EXPIRED:
+		return true
+	}
+	return false
+}
+
+// batchModel returns the publisher model resource of a model with batch prediction support.
+func batchModel(modelName string) (string, error) {
+	switch {
+	case strings.HasPrefix(modelName, "gemini"):
+		return "publishers/google/models/" + modelName, nil
+	case strings.HasPrefix(modelName, "claude"):
+		return "publishers/anthropic/models/" + modelName, nil
+	}
+	return "", fmt.Errorf("batch prediction jobs support Gemini and Claude models, not %s", modelName)
+}
+
+// batchIndexLabel is the request label holding a Gemini prompt's position in the submitted prompts,
+// as Gemini predictions don't carry an id, and label values can't hold any id.
+const batchIndexLabel = "gen_index"
+
+// geminiBatchRequest is a line of a Gemini batch prediction input file.
+type geminiBatchRequest struct {
+	Request struct {
+		Labels            map[string]string       `json:"labels,omitempty"`
+		Contents          []*genai.Content        `json:"contents"`
+		SystemInstruction *genai.Content          `json:"systemInstruction,omitempty"`
+		GenerationConfig  *genai.GenerationConfig `json:"generationConfig,omitempty"`
+		SafetySettings    []*genai.SafetySetting  `json:"safetySettings,omitempty"`
+		Tools             []*genai.Tool           `json:"tools,omitempty"`
+		ToolConfig        *genai.ToolConfig       `json:"toolConfig,omitempty"`
+	} `json:"request"`
+}
+
+// anthropicBatchRequest is a line of a Claude batch prediction input file.
+type anthropicBatchRequest struct {
+	CustomID string          `json:"custom_id"`
+	Request  json.RawMessage `json:"request"`
+}
+
+// BatchRequest returns the batch prediction input line of a conversation for a model.
+// Claude requests carry the id as their custom_id; Gemini requests are labelled with index,
+// the prompt's position in the submitted prompts, starting at 1.
+func BatchRequest(modelName, id string, index int, conv *Conversation, params GenerationParameters) ([]byte, error) {
+	if _, err := batchModel(modelName); err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(modelName, "claude") {
+		claudeRequest, _, err := anthropicRequest(conv, params)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(&claudeRequest)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling ClaudeRequest: %v", err)
+		}
+		data, err = mergeExtra(data, params.Extra)
+		if err != nil {
+			return nil, fmt.Errorf("error adding model parameters: %v", err)
+		}
+		return json.Marshal(anthropicBatchRequest{CustomID: id, Request: data})
+	}
+
+	config, err := geminiConfig(params)
+	if err != nil {
+		return nil, err
+	}
+	var line geminiBatchRequest
+	line.Request.Contents = geminiContents(conv)
+	if err := setGeminiBatchConfig(&line, config); err != nil {
+		return nil, err
+	}
+	if conv.System != "" {
+		line.Request.SystemInstruction = genai.NewContentFromText(conv.System, genai.RoleUser)
+	}
+	if line.Request.Labels == nil {
+		line.Request.Labels = map[string]string{}
+	}
+	line.Request.Labels[batchIndexLabel] = strconv.Itoa(index)
+	return json.Marshal(line)
+}
+
+// setGeminiBatchConfig sets the fields of a batch request from the config of a Gemini request,
+// as gen prompt sends it: the generation config, and the request's safety settings, tools and labels.
+// Parameters a batch request has no field for are refused rather than dropped.
+func setGeminiBatchConfig(line *geminiBatchRequest, config *genai.GenerateContentConfig) error {
+	line.Request.SafetySettings = config.SafetySettings
+	line.Request.Tools = config.Tools
+	line.Request.ToolConfig = config.ToolConfig
+	line.Request.Labels = config.Labels
+	line.Request.SystemInstruction = config.SystemInstruction
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, key := range []string{"safetySettings", "tools", "toolConfig", "labels", "systemInstruction"} {
+		delete(fields, key)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	known := jsonFields(genai.GenerationConfig{})
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !known[key] {
+			return fmt.Errorf("parameter %s isn't supported in batch predictions", key)
+		}
+	}
+	data, err = json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	line.Request.GenerationConfig = &genai.GenerationConfig{}
+	return json.Unmarshal(data, line.Request.GenerationConfig)
+}
+
+// jsonFields returns the JSON names of a struct's fields.
+func jsonFields(v interface{}) map[string]bool {
+	fields := map[string]bool{}
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// BatchPrediction is a line of a batch prediction output file.
+type BatchPrediction struct {
+	ID string
+	// Index is the position of a Gemini prompt in the submitted prompts, starting at 1, or 0 when unknown.
+	Index    int
+	Prompt   string
+	Response string
+	Usage    *Usage
+	Error    string
+}
+
+// ParseBatchPrediction reads a line of a Gemini or Claude batch prediction output file.
+func ParseBatchPrediction(line []byte) (BatchPrediction, error) {
+	var raw struct {
+		CustomID string          `json:"custom_id"`
+		Status   json.RawMessage `json:"status"`
+		Error    json.RawMessage `json:"error"`
+		Request  struct {
+			Labels   map[string]string `json:"labels"`
+			Contents []*genai.Content  `json:"contents"`
+			Messages []json.RawMessage `json:"messages"`
+		} `json:"request"`
+		Response json.RawMessage `json:"response"`
+	}
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return BatchPrediction{}, fmt.Errorf("error unmarshalling batch prediction: %v", err)
+	}
+
+	p := BatchPrediction{ID: raw.CustomID}
+	p.Index, _ = strconv.Atoi(raw.Request.Labels[batchIndexLabel])
+	for _, status := range []json.RawMessage{raw.Status, raw.Error} {
+		if msg := rawMessageText(status); msg != "" && p.Error == "" {
+			p.Error = msg
+		}
+	}
+
+	// the prompt is the last user turn of the request
+	if n := len(raw.Request.Contents); n > 0 {
+		for _, part := range raw.Request.Contents[n-1].Parts {
+			p.Prompt += part.Text
+		}
+	} else if n := len(raw.Request.Messages); n > 0 {
+		var m struct {
+			Content json.RawMessage `json:"content"`
+		}
+		if err := json.Unmarshal(raw.Request.Messages[n-1], &m); err == nil {
+			p.Prompt = anthropicText(m.Content)
+		}
+	}
+
+	if len(raw.Response) == 0 || string(raw.Response) == "null" {
+		return p, nil
+	}
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(raw.Response, &probe); err != nil {
+		return BatchPrediction{}, fmt.Errorf("error unmarshalling batch prediction response: %v", err)
+	}
+	if _, ok := probe["candidates"]; ok {
+		var resp genai.GenerateContentResponse
+		if err := json.Unmarshal(raw.Response, &resp); err != nil {
+			return BatchPrediction{}, fmt.Errorf("error unmarshalling GenerateContentResponse: %v", err)
+		}
+		p.Response = resp.Text()
+		if u := resp.UsageMetadata; u != nil {
+			p.Usage = &Usage{
+				InputTokens:  int(u.PromptTokenCount),
+				OutputTokens: int(u.CandidatesTokenCount + u.ThoughtsTokenCount),
+				CachedTokens: int(u.CachedContentTokenCount),
+			}
+		}
+		return p, nil
+	}
+
+	var resp AnthropicResponse
+	if err := json.Unmarshal(raw.Response, &resp); err != nil {
+		return BatchPrediction{}, fmt.Errorf("error unmarshalling AnthropicResponse: %v", err)
+	}
+	for _, content := range resp.Content {
+		p.Response += content.Text
+	}
+	if resp.Usage != nil {
+		u := resp.Usage
+		p.Usage = &Usage{
+			InputTokens:  u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens,
+			OutputTokens: u.OutputTokens,
+			CachedTokens: u.CacheReadInputTokens,
+		}
+	}
+	return p, nil
+}
+
+// anthropicText returns the text of Anthropic message content, a string or a list of content blocks.
+func anthropicText(content json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text
+	}
+	var blocks []AnthropicContent
+	_ = json.Unmarshal(content, &blocks)
+	for _, b := range blocks {
+		text += b.Text
+	}
+	return text
+}
+
+// rawMessageText returns a JSON string's value, or the JSON itself for other values, and "" for empty values.
+func rawMessageText(data json.RawMessage) string {
+	switch strings.TrimSpace(string(data)) {
+	case "", "null", `""`, "{}":
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		return text
+	}
+	return string(data)
+}
@@ -0,0 +1,276 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// fakeJobService is an in-memory JobService, keeping the batch prediction jobs it's given.
+type fakeJobService struct {
+	aiplatformpb.UnimplementedJobServiceServer
+
+	mu        sync.Mutex
+	jobs      []*aiplatformpb.BatchPredictionJob
+	parents   []string
+	cancelled []string
+}
+
+func (s *fakeJobService) CreateBatchPredictionJob(ctx context.Context, req *aiplatformpb.CreateBatchPredictionJobRequest) (*aiplatformpb.BatchPredictionJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := req.GetBatchPredictionJob()
+	job.Name = req.GetParent() + "/batchPredictionJobs/" + strconv.Itoa(len(s.jobs)+1)
+	job.State = aiplatformpb.JobState_JOB_STATE_PENDING
+	s.jobs = append(s.jobs, job)
+	s.parents = append(s.parents, req.GetParent())
+	return job, nil
+}
+
+func (s *fakeJobService) GetBatchPredictionJob(ctx context.Context, req *aiplatformpb.GetBatchPredictionJobRequest) (*aiplatformpb.BatchPredictionJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.Name == req.GetName() {
+			return job, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "job %s not found", req.GetName())
+}
+
+// ListBatchPredictionJobs returns a job per page, so listing follows page tokens.
+func (s *fakeJobService) ListBatchPredictionJobs(ctx context.Context, req *aiplatformpb.ListBatchPredictionJobsRequest) (*aiplatformpb.ListBatchPredictionJobsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, _ := strconv.Atoi(req.GetPageToken())
+	resp := &aiplatformpb.ListBatchPredictionJobsResponse{}
+	if i < len(s.jobs) {
+		resp.BatchPredictionJobs = s.jobs[i : i+1]
+	}
+	if i+1 < len(s.jobs) {
+		resp.NextPageToken = strconv.Itoa(i + 1)
+	}
+	return resp, nil
+}
+
+func (s *fakeJobService) CancelBatchPredictionJob(ctx context.Context, req *aiplatformpb.CancelBatchPredictionJobRequest) (*emptypb.Empty, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cancelled = append(s.cancelled, req.GetName())
+	return &emptypb.Empty{}, nil
+}
+
+// newTestBatchClient returns a BatchClient connected to a fake JobService over an in-memory connection.
+func newTestBatchClient(t *testing.T) (*BatchClient, *fakeJobService) {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	service := &fakeJobService{}
+	aiplatformpb.RegisterJobServiceServer(server, service)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewBatchClient(context.Background(), Config{ProjectID: "my-project", RegionID: "us-central1"}, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, service
+}
+
+func TestBatchClientSubmit(t *testing.T) {
+	client, service := newTestBatchClient(t)
+	ctx := context.Background()
+
+	job, err := client.Submit(ctx, "gen-batch-test", "gemini-2.5-flash", "gs://bucket/in.jsonl", "gs://bucket/out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "projects/my-project/locations/us-central1"; service.parents[0] != want {
+		t.Errorf("parent = %s, want %s", service.parents[0], want)
+	}
+	if want := "publishers/google/models/gemini-2.5-flash"; job.GetModel() != want {
+		t.Errorf("model = %s, want %s", job.GetModel(), want)
+	}
+	if uris := job.GetInputConfig().GetGcsSource().GetUris(); len(uris) != 1 || uris[0] != "gs://bucket/in.jsonl" {
+		t.Errorf("input = %v, want gs://bucket/in.jsonl", uris)
+	}
+	if prefix := job.GetOutputConfig().GetGcsDestination().GetOutputUriPrefix(); prefix != "gs://bucket/out" {
+		t.Errorf("output = %s, want gs://bucket/out", prefix)
+	}
+
+	if _, err := client.Submit(ctx, "gen-batch-test", "llama-3.3-70b-instruct-maas", "gs://bucket/in.jsonl", "gs://bucket/out"); err == nil {
+		t.Error("submitted a job for a model without batch prediction")
+	}
+	if len(service.jobs) != 1 {
+		t.Errorf("service has %d jobs, want 1", len(service.jobs))
+	}
+}
+
+func TestBatchClientStatus(t *testing.T) {
+	client, service := newTestBatchClient(t)
+	ctx := context.Background()
+	for _, name := range []string{"first", "second", "third"} {
+		if _, err := client.Submit(ctx, name, "claude-3-7-sonnet@20250219", "gs://bucket/in.jsonl", "gs://bucket/out"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a job is found by its id or its name
+	for _, id := range []string{"2", "projects/my-project/locations/us-central1/batchPredictionJobs/2"} {
+		job, err := client.Job(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.GetDisplayName() != "second" || JobDone(job) {
+			t.Errorf("job %s = %s, done %v, want second, not done", id, job.GetDisplayName(), JobDone(job))
+		}
+	}
+	_, err := client.Job(ctx, "9")
+	if status.Code(err) != codes.NotFound || !strings.Contains(err.Error(), "error getting batch prediction job 9") {
+		t.Errorf("error = %v, want a NotFound error for job 9", err)
+	}
+
+	for _, tt := range []struct{ limit, want int }{{0, 3}, {2, 2}} {
+		jobs, err := client.Jobs(ctx, tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs) != tt.want {
+			t.Errorf("Jobs(%d) returned %d jobs, want %d", tt.limit, len(jobs), tt.want)
+		}
+	}
+
+	if err := client.Cancel(ctx, "3"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "projects/my-project/locations/us-central1/batchPredictionJobs/3"; len(service.cancelled) != 1 || service.cancelled[0] != want {
+		t.Errorf("cancelled = %v, want %s", service.cancelled, want)
+	}
+
+	service.mu.Lock()
+	service.jobs[0].State = aiplatformpb.JobState_JOB_STATE_PARTIALLY_SUCCEEDED
+	service.mu.Unlock()
+	job, err := client.Job(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !JobDone(job) {
+		t.Errorf("job in state %s isn't done", job.GetState())
+	}
+}
+
+// predictionLine returns the output line a batch prediction job writes for a request line.
+func predictionLine(t *testing.T, request []byte, response string) []byte {
+	t.Helper()
+	var line map[string]json.RawMessage
+	if err := json.Unmarshal(request, &line); err != nil {
+		t.Fatal(err)
+	}
+	line["response"] = json.RawMessage(response)
+	data, err := json.Marshal(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestBatchResults(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    string
+		response string
+		want     BatchPrediction
+	}{
+		{
+			name:     "gemini",
+			model:    "gemini-2.5-flash",
+			response: `{"candidates":[{"content":{"role":"model","parts":[{"text":"hello"}]}}],"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":1}}`,
+			want:     BatchPrediction{Index: 2, Prompt: "hi", Response: "hello", Usage: &Usage{InputTokens: 3, OutputTokens: 1}},
+		},
+		{
+			name:     "claude",
+			model:    "claude-3-7-sonnet@20250219",
+			response: `{"content":[{"type":"text","text":"hello"}],"usage":{"input_tokens":3,"output_tokens":1}}`,
+			want:     BatchPrediction{ID: "b", Prompt: "hi", Response: "hello", Usage: &Usage{InputTokens: 3, OutputTokens: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the second of two identical prompts
+			request, err := BatchRequest(tt.model, "b", 2, NewConversation("hi"), GenerationParameters{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ParseBatchPrediction(predictionLine(t, request, tt.response))
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(tt.want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("prediction = %s\nwant %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestBatchRequestParameters(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "generation config and request fields",
+			params: `{"temperature":0.2,"thinkingConfig":{"thinkingBudget":0},"responseModalities":["TEXT"],"safetySettings":[{"category":"HARM_CATEGORY_HARASSMENT","threshold":"BLOCK_NONE"}],"labels":{"team":"docs"}}`,
+			want:   `{"request":{"labels":{"gen_index":"1","team":"docs"},"contents":[{"parts":[{"text":"hi"}],"role":"user"}],"generationConfig":{"responseModalities":["TEXT"],"temperature":0.2,"thinkingConfig":{"thinkingBudget":0}},"safetySettings":[{"category":"HARM_CATEGORY_HARASSMENT","threshold":"BLOCK_NONE"}]}}`,
+		},
+		{
+			name:    "unsupported parameter",
+			params:  `{"cachedContent":"projects/p/locations/l/cachedContents/c"}`,
+			wantErr: "parameter cachedContent isn't supported in batch predictions",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := ParseGenerationParameters([]byte(tt.params))
+			if err != nil {
+				t.Fatal(err)
+			}
+			request, err := BatchRequest("gemini-2.5-flash", "a", 1, NewConversation("hi"), params)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(request) != tt.want {
+				t.Errorf("request = %s\nwant %s", request, tt.want)
+			}
+		})
+	}
+}
@@ -2,10 +2,12 @@ package model
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync"
 
 	aiplatform "cloud.google.com/go/aiplatform/apiv1"
 	"google.golang.org/api/option"
@@ -14,9 +16,19 @@ import (
 // ModelClient is an interface for interacting with a generative AI model.
 type ModelClient interface {
 	// GenerateContent sends a prompt to the model and returns the generated content.
-	GenerateContent(ctx context.Context, w io.Writer, prompt string, parameters map[string]interface{}) error
+	GenerateContent(ctx context.Context, w io.Writer, prompt string, params GenerationParameters) error
+	// GenerateChat sends a conversation to the model as multi-turn input and appends the model's reply to it.
+	GenerateChat(ctx context.Context, w io.Writer, conv *Conversation, params GenerationParameters) error
+	// CountTokens returns the number of tokens in a conversation, as counted by the model's tokenizer
+	// or, for model families without a token counting api, estimated with EstimateTokens.
+	CountTokens(ctx context.Context, conv *Conversation) (TokenCount, error)
+	// Close releases the client's connections.
+	Close() error
 }
 
+// ErrUnknownModel is returned for a model that isn't of a family gen has a client for.
+var ErrUnknownModel = errors.New("unknown model")
+
 // NewClient creates a new model client based on the model name.
 func NewClient(ctx context.Context, cfg Config, modelName string) (ModelClient, error) {
 	if cfg.ProjectID == "" {
@@ -29,6 +41,13 @@ func NewClient(ctx context.Context, cfg Config, modelName string) (ModelClient,
 	if strings.HasPrefix(modelName, "gemini") {
 		return NewGeminiClient(ctx, cfg, modelName)
 	}
+	if strings.HasPrefix(modelName, "llama") {
+		return NewMetaClient(ctx, cfg, modelName)
+	}
+
+	if !strings.HasPrefix(modelName, "text-bison") && !strings.HasPrefix(modelName, "claude") {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownModel, modelName)
+	}
 
 	apiEndpoint := fmt.Sprintf("%s-aiplatform.googleapis.com:443", cfg.RegionID)
 	client, err := aiplatform.NewPredictionClient(ctx, option.WithEndpoint(apiEndpoint))
@@ -37,11 +56,74 @@ func NewClient(ctx context.Context, cfg Config, modelName string) (ModelClient,
 	}
 
 	if strings.HasPrefix(modelName, "text-bison") {
-		return &PaLMClient{client: client, cfg: cfg}, nil
-	} else if strings.HasPrefix(modelName, "claude") {
-		return &AnthropicClient{client: client, cfg: cfg}, nil
-	} else if strings.HasPrefix(modelName, "llama") {
-		return &MetaClient{client: client, cfg: cfg}, nil
+		return &PaLMClient{client: client, modelName: modelName, cfg: cfg}, nil
+	}
+	anthropicClient, err := NewAnthropicClient(client, cfg, modelName)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return anthropicClient, nil
+}
+
+// Clients creates a model client and an embedding client once for each model, to be reused
+// by a long running server until it's closed.
+type Clients struct {
+	cfg Config
+
+	mu        sync.Mutex
+	models    map[string]ModelClient
+	embedders map[string]EmbeddingClient
+}
+
+// NewClients returns a cache of the clients of the configured project's models.
+func NewClients(cfg Config) *Clients {
+	return &Clients{cfg: cfg, models: map[string]ModelClient{}, embedders: map[string]EmbeddingClient{}}
+}
+
+// Client returns the model client for a model, creating it on first use.
+func (c *Clients) Client(ctx context.Context, modelName string) (ModelClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.models[modelName]; ok {
+		return client, nil
+	}
+	// the client outlives the request it's created for
+	client, err := NewClient(context.WithoutCancel(ctx), c.cfg, modelName)
+	if err != nil {
+		return nil, err
+	}
+	c.models[modelName] = client
+	return client, nil
+}
+
+// Embedder returns the embedding client for a model, creating it on first use.
+func (c *Clients) Embedder(ctx context.Context, modelName string) (EmbeddingClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.embedders[modelName]; ok {
+		return client, nil
+	}
+	client, err := NewEmbeddingClient(context.WithoutCancel(ctx), c.cfg, modelName)
+	if err != nil {
+		return nil, err
+	}
+	c.embedders[modelName] = client
+	return client, nil
+}
+
+// Close closes every client created.
+func (c *Clients) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for name, client := range c.models {
+		errs = append(errs, client.Close())
+		delete(c.models, name)
+	}
+	for name, client := range c.embedders {
+		errs = append(errs, client.Close())
+		delete(c.embedders, name)
 	}
-	return nil, fmt.Errorf("unknown model: %s", modelName)
+	return errors.Join(errs...)
 }
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"context"
+	"testing"
+)
+
+func TestClients(t *testing.T) {
+	// an api key creates Gemini clients without credentials or requests
+	t.Setenv("GOOGLE_API_KEY", "test")
+	ctx := context.Background()
+	clients := NewClients(Config{ProjectID: "my-project", RegionID: "us-central1"})
+
+	first, err := clients.Client(ctx, "gemini-2.5-flash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := clients.Client(ctx, "gemini-2.5-flash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != again {
+		t.Error("a second client was created for the same model")
+	}
+	other, err := clients.Client(ctx, "gemini-2.5-pro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == first {
+		t.Error("models share a client")
+	}
+
+	if _, err := clients.Embedder(ctx, "gemini-embedding-001"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clients.Embedder(ctx, "gemini-2.5-flash"); err == nil {
+		t.Error("created an embedding client for a generative model")
+	}
+	if _, err := clients.Client(ctx, "gpt-4o"); err == nil {
+		t.Error("created a client for an unknown model")
+	}
+
+	if err := clients.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(clients.models) != 0 || len(clients.embedders) != 0 {
+		t.Errorf("%d clients left after closing", len(clients.models)+len(clients.embedders))
+	}
+}
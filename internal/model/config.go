@@ -1,29 +1,27 @@
 package model
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 )
 
 // Config is the configuration for the application.
 type Config struct {
-	ProjectID      string
-	RegionID       string
-	ConfigFile     string
-	LogType        string
-	OutputType     string
-	ModelParameters map[string]interface{}
+	ProjectID       string
+	RegionID        string
+	ConfigFile      string
+	LogType         string
+	OutputType      string
+	ModelParameters GenerationParameters
 }
 
 // ConfigBuilder is a builder for the Config struct.
 type ConfigBuilder struct {
-	projectID      string
-	regionID       string
-	configFile     string
-	logType        string
-	outputType     string
-	modelParameters map[string]interface{}
+	projectID  string
+	regionID   string
+	configFile string
+	logType    string
+	outputType string
 }
 
 // ProjectID sets the project ID.
@@ -75,15 +73,21 @@ func (b *ConfigBuilder) Build() (Config, error) {
 
 	cfg := Config{}
 
-	if b.projectID == "" {
+	cfg.ProjectID = b.projectID
+	if cfg.ProjectID == "" {
+		cfg.ProjectID = os.Getenv("GEN_PROJECT_ID")
+	}
+	// a Google AI API key can be used for Gemini models instead of a project
+	if cfg.ProjectID == "" && os.Getenv("GOOGLE_API_KEY") == "" {
 		return cfg, fmt.Errorf("need a valid GCP project ID")
 	}
-	cfg.ProjectID = b.projectID
 
-	if b.regionID == "" {
+	cfg.RegionID = b.regionID
+	if cfg.RegionID == "" {
+		cfg.RegionID = os.Getenv("GEN_REGION")
+	}
+	if cfg.RegionID == "" {
 		cfg.RegionID = "us-central1"
-	} else {
-		cfg.RegionID = b.regionID
 	}
 
 	cfg.ConfigFile = b.configFile
@@ -96,11 +100,10 @@ func (b *ConfigBuilder) Build() (Config, error) {
 			return cfg, fmt.Errorf("error reading model config: %v", err)
 		}
 
-		err = json.Unmarshal(data, &b.modelParameters)
+		cfg.ModelParameters, err = ParseGenerationParameters(data)
 		if err != nil {
 			return cfg, fmt.Errorf("error unmarshalling model config: %v", err)
 		}
-		cfg.ModelParameters = b.modelParameters
 	}
 
 	return cfg, nil
@@ -0,0 +1,88 @@
+package model
+
+import "strings"
+
+// Role is the author of a message in a conversation.
+type Role string
+
+const (
+	// RoleUser is a message authored by the user.
+	RoleUser Role = "user"
+	// RoleModel is a message authored by the model.
+	RoleModel Role = "model"
+)
+
+// Message is a single turn in a conversation.
+type Message struct {
+	Role        Role         `json:"role"`
+	Text        string       `json:"text"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// ToolCalls are the tools a model message asks to call.
+	ToolCalls []ToolCall `json:"toolCalls,omitempty"`
+	// ToolResults are the outputs of the tool calls, sent in a user message.
+	ToolResults []ToolResult `json:"toolResults,omitempty"`
+	// Usage is the token usage reported for a model message.
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// Conversation is an ordered list of messages exchanged with a model,
+// with optional system instructions that apply to the whole conversation.
+type Conversation struct {
+	System   string    `json:"system,omitempty"`
+	Messages []Message `json:"messages"`
+}
+
+// NewConversation returns a conversation with a single user message.
+func NewConversation(prompt string, attachments ...Attachment) *Conversation {
+	conv := &Conversation{}
+	conv.AddUser(prompt, attachments...)
+	return conv
+}
+
+// AddUser appends a user message, with any attachments, to the conversation.
+func (c *Conversation) AddUser(text string, attachments ...Attachment) {
+	c.Messages = append(c.Messages, Message{Role: RoleUser, Text: text, Attachments: attachments})
+}
+
+// AddModel appends a model message to the conversation.
+func (c *Conversation) AddModel(text string) {
+	c.Messages = append(c.Messages, Message{Role: RoleModel, Text: text})
+}
+
+// addReply appends a model message with the token usage reported for it.
+func (c *Conversation) addReply(text string, usage *Usage) {
+	c.Messages = append(c.Messages, Message{Role: RoleModel, Text: text, Usage: usage})
+}
+
+// LastUsage returns the token usage reported for the last message, if any.
+func (c *Conversation) LastUsage() *Usage {
+	if len(c.Messages) == 0 {
+		return nil
+	}
+	return c.Messages[len(c.Messages)-1].Usage
+}
+
+// Transcript renders the conversation as plain text, for models without a native chat api.
+func (c *Conversation) Transcript() (string, error) {
+	if len(c.Messages) == 1 && c.System == "" {
+		return c.Messages[0].textPrompt()
+	}
+	var sb strings.Builder
+	if c.System != "" {
+		sb.WriteString(c.System)
+		sb.WriteString("\n\n")
+	}
+	for _, m := range c.Messages {
+		text, err := m.textPrompt()
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(string(m.Role))
+		sb.WriteString(": ")
+		sb.WriteString(text)
+		sb.WriteString("\n")
+	}
+	sb.WriteString(string(RoleModel))
+	sb.WriteString(": ")
+	return sb.String(), nil
+}
@@ -0,0 +1,196 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/aiplatform/apiv1"
+	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
+	"google.golang.org/api/option"
+	"google.golang.org/genai"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// EmbeddingClient is an interface for embedding text with an embedding model.
+type EmbeddingClient interface {
+	// Embed returns an embedding for each text, in order.
+	Embed(ctx context.Context, texts []string, opts EmbedOptions) ([]Embedding, error)
+	// Close releases the client's connections.
+	Close() error
+}
+
+// EmbedOptions are the options of an embedding request.
+type EmbedOptions struct {
+	// TaskType is the intended use of the embeddings, such as RETRIEVAL_DOCUMENT, RETRIEVAL_QUERY or SEMANTIC_SIMILARITY.
+	TaskType string
+	// Dimensionality reduces the size of the embeddings, for models that support it.
+	Dimensionality int32
+	// Title is the title of the texts, used with the RETRIEVAL_DOCUMENT task type.
+	Title string
+}
+
+// Embedding is the embedding of a text.
+type Embedding struct {
+	Values    []float32 `json:"values"`
+	Tokens    int       `json:"tokens,omitempty"`
+	Truncated bool      `json:"truncated,omitempty"`
+}
+
+// textEmbeddingBatchSize is the number of texts sent in each textembedding prediction request.
+const textEmbeddingBatchSize = 25
+
+// NewEmbeddingClient creates an embedding client based on the model name.
+func NewEmbeddingClient(ctx context.Context, cfg Config, modelName string) (EmbeddingClient, error) {
+	if cfg.ProjectID == "" {
+		cfg.ProjectID = os.Getenv("GEN_PROJECT_ID")
+	}
+	if cfg.RegionID == "" {
+		cfg.RegionID = os.Getenv("GEN_REGION")
+	}
+
+	switch {
+	case strings.HasPrefix(modelName, "gemini-embedding"):
+		return NewGeminiClient(ctx, cfg, modelName)
+	case isTextEmbeddingModel(modelName):
+		apiEndpoint := fmt.Sprintf("%s-aiplatform.googleapis.com:443", cfg.RegionID)
+		client, err := aiplatform.NewPredictionClient(ctx, option.WithEndpoint(apiEndpoint))
+		if err != nil {
+			return nil, fmt.Errorf("unable to create prediction client: %v", err)
+		}
+		return &TextEmbeddingClient{client: client, modelName: modelName, cfg: cfg}, nil
+	}
+	return nil, fmt.Errorf("%w: %s isn't an embedding model, see `gen models` for the embeddings models", ErrUnknownModel, modelName)
+}
+
+// isTextEmbeddingModel reports whether a model is one of Vertex AI's text embedding models.
+func isTextEmbeddingModel(modelName string) bool {
+	for _, prefix := range []string{"textembedding", "text-embedding", "text-multilingual-embedding"} {
+		if strings.HasPrefix(modelName, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Embed embeds texts with a Gemini embedding model, one text per request.
+func (c *GeminiClient) Embed(ctx context.Context, texts []string, opts EmbedOptions) ([]Embedding, error) {
+	config := &genai.EmbedContentConfig{
+		TaskType: strings.ToUpper(opts.TaskType),
+		Title:    opts.Title,
+	}
+	if opts.Dimensionality > 0 {
+		config.OutputDimensionality = &opts.Dimensionality
+	}
+
+	embeddings := make([]Embedding, 0, len(texts))
+	for _, text := range texts {
+		resp, err := c.client.EmbedContent(ctx, c.modelName, []*genai.Content{genai.NewContentFromText(text, genai.RoleUser)}, config)
+		if err != nil {
+			return nil, fmt.Errorf("error embedding content: %w", err)
+		}
+		if len(resp.Embeddings) == 0 {
+			return nil, fmt.Errorf("no embedding returned by %s", c.modelName)
+		}
+		e := resp.Embeddings[0]
+		embedding := Embedding{Values: e.Values}
+		if e.Statistics != nil {
+			embedding.Tokens = int(e.Statistics.TokenCount)
+			embedding.Truncated = e.Statistics.Truncated
+		}
+		embeddings = append(embeddings, embedding)
+	}
+	return embeddings, nil
+}
+
+// TextEmbeddingClient is a client for Vertex AI's text embedding models, such as text-embedding-005.
+type TextEmbeddingClient struct {
+	client    *aiplatform.PredictionClient
+	modelName string
+	cfg       Config
+}
+
+// textEmbeddingResponse is the prediction response of a text embedding model.
+type textEmbeddingResponse struct {
+	Predictions []struct {
+		Embeddings struct {
+			Values     []float32 `json:"values"`
+			Statistics struct {
+				TokenCount float64 `json:"token_count"`
+				Truncated  bool    `json:"truncated"`
+			} `json:"statistics"`
+		} `json:"embeddings"`
+	} `json:"predictions"`
+}
+
+// Close closes the connection to the api.
+func (c *TextEmbeddingClient) Close() error {
+	return c.client.Close()
+}
+
+// Embed embeds texts with a text embedding model, several texts per request.
+func (c *TextEmbeddingClient) Embed(ctx context.Context, texts []string, opts EmbedOptions) ([]Embedding, error) {
+	url := fmt.Sprintf("projects/%s/locations/%s/publishers/google/models/%s", c.cfg.ProjectID, c.cfg.RegionID, c.modelName)
+	if c.cfg.LogType != "none" {
+		log.Printf("url: %s", url)
+	}
+
+	parameters := map[string]interface{}{"autoTruncate": true}
+	if opts.Dimensionality > 0 {
+		parameters["outputDimensionality"] = float64(opts.Dimensionality)
+	}
+	parametersValue, err := structpb.NewValue(parameters)
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert parameters to Value: %v", err)
+	}
+
+	embeddings := make([]Embedding, 0, len(texts))
+	for start := 0; start < len(texts); start += textEmbeddingBatchSize {
+		batch := texts[start:min(start+textEmbeddingBatchSize, len(texts))]
+		instances := make([]*structpb.Value, 0, len(batch))
+		for _, text := range batch {
+			instance := map[string]interface{}{"content": text}
+			if opts.TaskType != "" {
+				instance["task_type"] = strings.ToUpper(opts.TaskType)
+			}
+			if opts.Title != "" {
+				instance["title"] = opts.Title
+			}
+			value, err := structpb.NewValue(instance)
+			if err != nil {
+				return nil, fmt.Errorf("unable to convert text to Value: %v", err)
+			}
+			instances = append(instances, value)
+		}
+
+		resp, err := c.client.Predict(ctx, &aiplatformpb.PredictRequest{
+			Endpoint:   url,
+			Instances:  instances,
+			Parameters: parametersValue,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error in prediction: %w", err)
+		}
+
+		var r textEmbeddingResponse
+		structbytes, _ := protojson.Marshal(resp)
+		if err := json.Unmarshal(structbytes, &r); err != nil {
+			return nil, fmt.Errorf("unable to convert to struct: %v", err)
+		}
+		if len(r.Predictions) != len(batch) {
+			return nil, fmt.Errorf("%s returned %d embeddings for %d texts", c.modelName, len(r.Predictions), len(batch))
+		}
+		for _, p := range r.Predictions {
+			embeddings = append(embeddings, Embedding{
+				Values:    p.Embeddings.Values,
+				Tokens:    int(p.Embeddings.Statistics.TokenCount),
+				Truncated: p.Embeddings.Statistics.Truncated,
+			})
+		}
+	}
+	return embeddings, nil
+}
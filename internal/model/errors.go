@@ -0,0 +1,70 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"google.golang.org/genai"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// HTTPError is an unsuccessful response from a model's HTTP endpoint.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Status, e.Body)
+}
+
+// anthropicError is an error event in an Anthropic response stream.
+type anthropicError struct {
+	Type    string
+	Message string
+}
+
+func (e *anthropicError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+// IsTransient reports whether a generation error may succeed when retried,
+// such as rate limiting, overloaded or unavailable servers and timeouts.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		return transientStatus(apiErr.Code)
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return transientStatus(httpErr.StatusCode)
+	}
+	var streamErr *anthropicError
+	if errors.As(err, &streamErr) {
+		return streamErr.Type == "overloaded_error" || streamErr.Type == "rate_limit_error" || streamErr.Type == "api_error"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted, codes.Internal:
+			return true
+		}
+	}
+	return false
+}
+
+// transientStatus reports whether an HTTP status code is worth retrying.
+func transientStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"strings"
 
 	"google.golang.org/genai"
 )
@@ -14,6 +15,7 @@ import (
 // GeminiClient is a client for the Gemini model.
 type GeminiClient struct {
 	client    *genai.Models
+	backend   genai.Backend
 	modelName string
 	cfg       Config
 }
@@ -39,39 +41,191 @@ func NewGeminiClient(ctx context.Context, cfg Config, modelName string) (*Gemini
 
 	return &GeminiClient{
 		client:    client.Models,
+		backend:   client.ClientConfig().Backend,
 		modelName: modelName,
 		cfg:       cfg,
 	}, nil
 }
 
+// Close does nothing, as the genai client keeps no connections of its own.
+func (c *GeminiClient) Close() error {
+	return nil
+}
+
 // GenerateContent generates content from the Gemini model.
-func (c *GeminiClient) GenerateContent(ctx context.Context, w io.Writer, prompt string, parameters map[string]interface{}) error {
-	var config *genai.GenerateContentConfig
-	if c.cfg.ConfigFile != "" {
-		modelConfig, err := os.ReadFile(c.cfg.ConfigFile)
-		if err != nil {
-			return fmt.Errorf("error reading model config file: %w", err)
-		}
-		err = json.Unmarshal(modelConfig, &config)
-		if err != nil {
-			return fmt.Errorf("error unmarshalling GenerationConfig from file: %w", err)
-		}
-		if c.cfg.LogType != "none" {
-			log.Printf("config: %v", config)
-		}
+func (c *GeminiClient) GenerateContent(ctx context.Context, w io.Writer, prompt string, params GenerationParameters) error {
+	return c.GenerateChat(ctx, w, NewConversation(prompt), params)
+}
+
+// GenerateChat generates the next turn of a conversation from the Gemini model.
+func (c *GeminiClient) GenerateChat(ctx context.Context, w io.Writer, conv *Conversation, params GenerationParameters) error {
+	config, err := geminiConfig(params)
+	if err != nil {
+		return err
+	}
+	if conv.System != "" {
+		config.SystemInstruction = genai.NewContentFromText(conv.System, genai.RoleUser)
+	}
+	if c.cfg.LogType != "none" {
+		log.Printf("config: %v", config)
 	}
 
-	for result, err := range c.client.GenerateContentStream(ctx, c.modelName, genai.Text(prompt), config) {
+	var reply strings.Builder
+	var usage *Usage
+	var calls []ToolCall
+	for result, err := range c.client.GenerateContentStream(ctx, c.modelName, geminiContents(conv), config) {
 		if err != nil {
 			return err
 		}
+		text, chunkCalls := geminiParts(result)
+		reply.WriteString(text)
+		calls = append(calls, chunkCalls...)
+		// the usage is cumulative, so the last chunk's usage is the total
+		if u := result.UsageMetadata; u != nil {
+			usage = &Usage{
+				InputTokens:  int(u.PromptTokenCount),
+				OutputTokens: int(u.CandidatesTokenCount + u.ThoughtsTokenCount),
+				CachedTokens: int(u.CachedContentTokenCount),
+			}
+		}
 		if c.cfg.OutputType == "json" {
-			rb, _ := json.MarshalIndent(result, "", "  ")
+			rb, _ := json.Marshal(result)
 			fmt.Fprintln(w, string(rb))
 		} else {
-			fmt.Fprint(w, result.Text())
+			fmt.Fprint(w, text)
 		}
 	}
+	if len(calls) > 0 {
+		conv.addToolReply(reply.String(), calls, usage)
+		return nil
+	}
+	conv.addReply(reply.String(), usage)
 
 	return nil
 }
+
+// geminiContents converts a conversation to Gemini contents.
+func geminiContents(conv *Conversation) []*genai.Content {
+	contents := make([]*genai.Content, 0, len(conv.Messages))
+	for _, m := range conv.Messages {
+		role := genai.RoleUser
+		if m.Role == RoleModel {
+			role = genai.RoleModel
+		}
+		var parts []*genai.Part
+		if m.Text != "" || (len(m.ToolCalls) == 0 && len(m.ToolResults) == 0) {
+			parts = append(parts, genai.NewPartFromText(m.Text))
+		}
+		for _, a := range m.Attachments {
+			if a.IsText() {
+				parts = append(parts, genai.NewPartFromText(a.text()))
+			} else {
+				parts = append(parts, genai.NewPartFromBytes(a.Data, a.MIMEType))
+			}
+		}
+		for _, call := range m.ToolCalls {
+			part := genai.NewPartFromFunctionCall(call.Name, call.Args)
+			part.FunctionCall.ID = call.ID
+			part.ThoughtSignature = call.Signature
+			parts = append(parts, part)
+		}
+		for _, result := range m.ToolResults {
+			response := map[string]any{"output": result.Content}
+			if result.IsError {
+				response = map[string]any{"error": result.Content}
+			}
+			part := genai.NewPartFromFunctionResponse(result.Name, response)
+			part.FunctionResponse.ID = result.ID
+			parts = append(parts, part)
+		}
+		contents = append(contents, genai.NewContentFromParts(parts, genai.Role(role)))
+	}
+	return contents
+}
+
+// geminiParts returns the text and the function calls of a response chunk, skipping thoughts.
+func geminiParts(result *genai.GenerateContentResponse) (string, []ToolCall) {
+	if len(result.Candidates) == 0 || result.Candidates[0].Content == nil {
+		return "", nil
+	}
+	var text strings.Builder
+	var calls []ToolCall
+	for _, part := range result.Candidates[0].Content.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			calls = append(calls, ToolCall{
+				ID:        part.FunctionCall.ID,
+				Name:      part.FunctionCall.Name,
+				Args:      part.FunctionCall.Args,
+				Signature: part.ThoughtSignature,
+			})
+		case part.Text != "" && !part.Thought:
+			text.WriteString(part.Text)
+		}
+	}
+	return text.String(), calls
+}
+
+// geminiConfig maps generation parameters to a Gemini generation config.
+// Extra parameters are read as GenerateContentConfig fields, such as candidateCount or safetySettings.
+func geminiConfig(params GenerationParameters) (*genai.GenerateContentConfig, error) {
+	config := &genai.GenerateContentConfig{}
+	if len(params.Extra) > 0 {
+		data, _ := json.Marshal(params.Extra)
+		if err := json.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("error unmarshalling GenerationConfig from parameters: %w", err)
+		}
+	}
+	config.Temperature = params.Temperature
+	config.TopP = params.TopP
+	config.TopK = params.TopK
+	config.MaxOutputTokens = params.MaxOutputTokens
+	config.StopSequences = params.StopSequences
+	config.Seed = params.Seed
+	if params.ResponseSchema != nil {
+		config.ResponseMIMEType = "application/json"
+		schema, err := geminiSchema(params.ResponseSchema)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported response schema for Gemini models: %w", err)
+		}
+		config.ResponseSchema = schema
+	}
+	if len(params.Tools) > 0 {
+		declarations := make([]*genai.FunctionDeclaration, 0, len(params.Tools))
+		for _, t := range params.Tools {
+			declaration := &genai.FunctionDeclaration{Name: t.Name, Description: t.Description}
+			if t.Parameters != nil {
+				// recursive schemas, which Gemini's OpenAPI schema can't express, are sent as JSON Schema
+				schema, err := geminiSchema(t.Parameters)
+				if err != nil {
+					declaration.ParametersJsonSchema = map[string]interface{}(t.Parameters)
+				} else {
+					declaration.Parameters = schema
+				}
+			}
+			declarations = append(declarations, declaration)
+		}
+		config.Tools = []*genai.Tool{{FunctionDeclarations: declarations}}
+	}
+	return config, nil
+}
+
+// CountTokens counts the tokens in a conversation with the Gemini model's tokenizer.
+func (c *GeminiClient) CountTokens(ctx context.Context, conv *Conversation) (TokenCount, error) {
+	contents := geminiContents(conv)
+	var config *genai.CountTokensConfig
+	if conv.System != "" {
+		if c.backend == genai.BackendVertexAI {
+			config = &genai.CountTokensConfig{SystemInstruction: genai.NewContentFromText(conv.System, genai.RoleUser)}
+		} else {
+			// the Gemini API doesn't count system instructions, so they're counted as a user turn
+			contents = append([]*genai.Content{genai.NewContentFromText(conv.System, genai.RoleUser)}, contents...)
+		}
+	}
+
+	resp, err := c.client.CountTokens(ctx, c.modelName, contents, config)
+	if err != nil {
+		return TokenCount{}, err
+	}
+	return TokenCount{Model: c.modelName, TotalTokens: int(resp.TotalTokens)}, nil
+}
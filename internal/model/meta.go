@@ -1,77 +1,233 @@
 package model
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"strings"
 
-	"cloud.google.com/go/aiplatform/apiv1"
-	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
-	"google.golang.org/genproto/googleapis/api/httpbody"
+	"golang.org/x/oauth2/google"
 )
 
-// MetaClient is a client for the Meta model.
+// MetaClient is a client for Meta's Llama models, served as a model-as-a-service (MaaS)
+// through Vertex AI's OpenAI-compatible chat completions endpoint.
 type MetaClient struct {
-	client *aiplatform.PredictionClient
-	cfg    Config
+	httpClient *http.Client
+	endpoint   string
+	modelName  string
+	cfg        Config
+}
+
+// MetaOption configures a MetaClient.
+type MetaOption func(*metaOptions)
+
+type metaOptions struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// WithMetaBaseURL sends requests to baseURL, such as a local stand-in, rather than the regional Vertex AI endpoint.
+func WithMetaBaseURL(baseURL string) MetaOption {
+	return func(o *metaOptions) {
+		o.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithMetaHTTPClient sends requests with httpClient rather than a client authenticated with application default credentials.
+func WithMetaHTTPClient(httpClient *http.Client) MetaOption {
+	return func(o *metaOptions) {
+		o.httpClient = httpClient
+	}
+}
+
+// NewMetaClient creates a new Llama MaaS client authenticated with application default credentials.
+func NewMetaClient(ctx context.Context, cfg Config, modelName string, opts ...MetaOption) (*MetaClient, error) {
+	o := metaOptions{baseURL: fmt.Sprintf("https://%s-aiplatform.googleapis.com", cfg.RegionID)}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.httpClient == nil {
+		httpClient, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/cloud-platform")
+		if err != nil {
+			return nil, fmt.Errorf("unable to create authenticated http client: %v", err)
+		}
+		o.httpClient = httpClient
+	}
+
+	return &MetaClient{
+		httpClient: o.httpClient,
+		endpoint: fmt.Sprintf("%s/v1beta1/projects/%s/locations/%s/endpoints/openapi/chat/completions",
+			o.baseURL, cfg.ProjectID, cfg.RegionID),
+		modelName: modelName,
+		cfg:       cfg,
+	}, nil
+}
+
+// Close closes the client's idle connections.
+func (c *MetaClient) Close() error {
+	c.httpClient.CloseIdleConnections()
+	return nil
 }
 
 // GenerateContent generates content from the Meta model.
-func (c *MetaClient) GenerateContent(ctx context.Context, w io.Writer, prompt string, parameters map[string]interface{}) error {
-	// Endpoint
-	base := fmt.Sprintf("projects/%s/locations/%s/publishers/%s/models", c.cfg.ProjectID, c.cfg.RegionID, "meta")
-	url := fmt.Sprintf("%s/%s", base, "llama3-8b")
+func (c *MetaClient) GenerateContent(ctx context.Context, w io.Writer, prompt string, params GenerationParameters) error {
+	return c.GenerateChat(ctx, w, NewConversation(prompt), params)
+}
+
+// GenerateChat generates the next turn of a conversation from the Meta model.
+func (c *MetaClient) GenerateChat(ctx context.Context, w io.Writer, conv *Conversation, params GenerationParameters) error {
+	if len(params.Tools) > 0 {
+		return fmt.Errorf("tools aren't supported for Llama models, use a Gemini or Claude model")
+	}
 	if c.cfg.LogType != "none" {
-		log.Printf("url: %s", url)
+		log.Printf("url: %s", c.endpoint)
+	}
+
+	// structured output is requested with instructions in the system message
+	request := conv
+	if params.ResponseSchema != nil {
+		withSchema := *conv
+		withSchema.System = schemaInstructions(conv.System, params.ResponseSchema)
+		request = &withSchema
+	}
+	messages, err := llamaMessages(request)
+	if err != nil {
+		return err
 	}
 
-	// Construct a Llama message.
+	// Construct a Llama chat completion request; MaaS models are addressed as publisher/model.
 	llamaRequest := LlamaRequest{
-		AnthropicVersion: "vertex-2023-10-16",
-		MaxTokens:        256,
-		Stream:           false,
-		Messages: []AnthropicMessage{
-			{
-				Content: []AnthropicContent{
-					{
-						Text: prompt,
-						Type: "text",
-					},
-				},
-				Role: "user",
-			},
-		},
+		Model:       "meta/" + c.modelName,
+		MaxTokens:   params.maxOutputTokens(),
+		Temperature: params.Temperature,
+		TopP:        params.TopP,
+		Stop:        params.StopSequences,
+		Seed:        params.Seed,
+		Stream:      true,
+		// the usage is sent in a final chunk
+		StreamOptions: &LlamaStreamOptions{IncludeUsage: true},
+		Messages:      messages,
 	}
 
 	data, err := json.Marshal(&llamaRequest)
 	if err != nil {
 		return fmt.Errorf("error marshalling LlamaRequest: %v", err)
 	}
+	// top_k isn't part of the OpenAI schema, but is accepted by Llama MaaS
+	extra := params.Extra
+	if params.TopK != nil {
+		extra = map[string]interface{}{"top_k": int(*params.TopK)}
+		for k, v := range params.Extra {
+			extra[k] = v
+		}
+	}
+	data, err = mergeExtra(data, extra)
+	if err != nil {
+		return fmt.Errorf("error adding model parameters: %v", err)
+	}
 
-	// using RawPredict
-	req := &aiplatformpb.RawPredictRequest{
-		Endpoint: url,
-		HttpBody: &httpbody.HttpBody{
-			ContentType: "application/json",
-			Data:        data,
-		},
+	body, err := c.post(ctx, data)
+	if err != nil {
+		return err
 	}
+	defer body.Close()
 
-	resp, err := c.client.RawPredict(ctx, req)
+	// the streamed response is a series of chat completion chunks, as server-sent events
+	var reply strings.Builder
+	var usage *Usage
+	choices := 0
+	err = readEvents(body, func(event, data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+		if c.cfg.OutputType == "json" {
+			fmt.Fprintln(w, data)
+		}
+		var chunk LlamaStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("error unmarshalling LlamaStreamChunk: %v", err)
+		}
+		choices += len(chunk.Choices)
+		for _, choice := range chunk.Choices {
+			reply.WriteString(choice.Delta.Content)
+			if c.cfg.OutputType != "json" {
+				fmt.Fprint(w, choice.Delta.Content)
+			}
+			if choice.FinishReason != "" && c.cfg.LogType != "none" {
+				log.Printf("finish_reason: %s", choice.FinishReason)
+			}
+		}
+		if chunk.Usage != nil {
+			usage = &Usage{
+				InputTokens:  chunk.Usage.PromptTokens,
+				OutputTokens: chunk.Usage.CompletionTokens,
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("error in prediction: %v", err)
+		return fmt.Errorf("error reading response: %v", err)
+	}
+	// without a reply, the conversation would end with the user's turn, so it's an error for the caller to drop
+	if choices == 0 {
+		return fmt.Errorf("error in prediction: no choices in the response")
 	}
+	conv.addReply(reply.String(), usage)
 
-	if c.cfg.OutputType == "json" {
-		fmt.Fprintln(w, string(resp.Data))
-	} else {
-		var r LlamaResponse
-		_ = json.Unmarshal(resp.Data, &r)
-		fmt.Fprintf(w, "%v", r.Content[0].Text)
+	return nil
+}
 
+// post sends a chat completions request and returns the response body.
+func (c *MetaClient) post(ctx context.Context, data []byte) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
 	}
+	req.Header.Set("Content-Type", "application/json")
 
-	return nil
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error in prediction: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("error in prediction: %w", &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(bytes.TrimSpace(body))})
+	}
+	return resp.Body, nil
+}
+
+// llamaMessages converts a conversation to Llama chat messages.
+func llamaMessages(conv *Conversation) ([]LlamaMessage, error) {
+	messages := make([]LlamaMessage, 0, len(conv.Messages)+1)
+	if conv.System != "" {
+		messages = append(messages, LlamaMessage{
+			Role:    "system",
+			Content: conv.System,
+		})
+	}
+	for _, m := range conv.Messages {
+		role := "user"
+		if m.Role == RoleModel {
+			role = "assistant"
+		}
+		text, err := m.textPrompt()
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, LlamaMessage{
+			Role:    role,
+			Content: text,
+		})
+	}
+	return messages, nil
+}
+
+// CountTokens estimates the tokens in a conversation, as Llama MaaS has no token counting api.
+func (c *MetaClient) CountTokens(ctx context.Context, conv *Conversation) (TokenCount, error) {
+	return estimatedTokenCount(c.modelName, conv), nil
 }
@@ -0,0 +1,262 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestMetaClient returns a MetaClient sending its requests to a local stand-in.
+func newTestMetaClient(t *testing.T, handler http.HandlerFunc, cfg Config) *MetaClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	cfg.ProjectID, cfg.RegionID = "my-project", "us-central1"
+	c, err := NewMetaClient(context.Background(), cfg, "llama-3.3-70b-instruct-maas",
+		WithMetaBaseURL(server.URL), WithMetaHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// sseChunks writes each chunk as a server-sent event, followed by [DONE].
+func sseChunks(w http.ResponseWriter, chunks ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, c := range chunks {
+		fmt.Fprintf(w, "data: %s\n\n", c)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func float32Ptr(f float32) *float32 {
+	return &f
+}
+
+func TestMetaRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		conv   *Conversation
+		params GenerationParameters
+		want   map[string]interface{}
+	}{
+		{
+			name: "prompt with defaults",
+			conv: NewConversation("hi"),
+			want: map[string]interface{}{
+				"model":          "meta/llama-3.3-70b-instruct-maas",
+				"max_tokens":     float64(DefaultMaxOutputTokens),
+				"stream":         true,
+				"stream_options": map[string]interface{}{"include_usage": true},
+				"messages":       []interface{}{map[string]interface{}{"role": "user", "content": "hi"}},
+			},
+		},
+		{
+			name: "conversation with system and parameters",
+			conv: func() *Conversation {
+				c := NewConversation("hi")
+				c.System = "be brief"
+				c.AddModel("hello")
+				c.AddUser("how are you?")
+				return c
+			}(),
+			params: GenerationParameters{
+				Temperature:     float32Ptr(0.5),
+				TopK:            float32Ptr(40),
+				MaxOutputTokens: 100,
+				StopSequences:   []string{"END"},
+				Extra:           map[string]interface{}{"presence_penalty": 0.1},
+			},
+			want: map[string]interface{}{
+				"model":            "meta/llama-3.3-70b-instruct-maas",
+				"max_tokens":       float64(100),
+				"temperature":      0.5,
+				"top_k":            float64(40),
+				"stop":             []interface{}{"END"},
+				"presence_penalty": 0.1,
+				"stream":           true,
+				"stream_options":   map[string]interface{}{"include_usage": true},
+				"messages": []interface{}{
+					map[string]interface{}{"role": "system", "content": "be brief"},
+					map[string]interface{}{"role": "user", "content": "hi"},
+					map[string]interface{}{"role": "assistant", "content": "hello"},
+					map[string]interface{}{"role": "user", "content": "how are you?"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]interface{}
+			var path string
+			c := newTestMetaClient(t, func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("invalid request body: %v", err)
+				}
+				sseChunks(w, `{"choices":[{"index":0,"delta":{"content":"ok"}}]}`)
+			}, Config{})
+
+			if err := c.GenerateChat(context.Background(), io.Discard, tt.conv, tt.params); err != nil {
+				t.Fatal(err)
+			}
+			if want := "/v1beta1/projects/my-project/locations/us-central1/endpoints/openapi/chat/completions"; path != want {
+				t.Errorf("path = %s, want %s", path, want)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("request = %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetaResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunks  []string
+		output  string
+		want    string
+		usage   *Usage
+		logged  string
+		wantErr string
+	}{
+		{
+			name: "streamed choices and usage",
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"}}]}`,
+				`{"choices":[{"index":0,"delta":{"content":", world"},"finish_reason":"stop"}]}`,
+				`{"choices":[],"usage":{"prompt_tokens":7,"completion_tokens":3,"total_tokens":10}}`,
+			},
+			want:   "Hello, world",
+			usage:  &Usage{InputTokens: 7, OutputTokens: 3},
+			logged: "finish_reason: stop",
+		},
+		{
+			name:   "truncated reply",
+			chunks: []string{`{"choices":[{"index":0,"delta":{"content":"Once upon"},"finish_reason":"length"}]}`},
+			want:   "Once upon",
+			logged: "finish_reason: length",
+		},
+		{
+			name: "json output",
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"content":"hi"}}]}`,
+			},
+			output: "json",
+			want:   "hi",
+		},
+		{
+			name:    "no choices",
+			chunks:  []string{`{"choices":[],"usage":{"prompt_tokens":7,"completion_tokens":0,"total_tokens":7}}`},
+			wantErr: "no choices in the response",
+		},
+		{
+			name:    "malformed chunk",
+			chunks:  []string{`{"choices":`},
+			wantErr: "error unmarshalling LlamaStreamChunk",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			c := newTestMetaClient(t, func(w http.ResponseWriter, r *http.Request) {
+				sseChunks(w, tt.chunks...)
+			}, Config{LogType: "verbose", OutputType: tt.output})
+
+			var w strings.Builder
+			conv := NewConversation("hi")
+			err := c.GenerateChat(context.Background(), &w, conv, GenerationParameters{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				if len(conv.Messages) != 1 {
+					t.Errorf("conversation has %d messages after an error, want the prompt only", len(conv.Messages))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reply := conv.Messages[len(conv.Messages)-1]
+			if reply.Role != RoleModel || reply.Text != tt.want {
+				t.Errorf("reply = %s %q, want %q", reply.Role, reply.Text, tt.want)
+			}
+			if !reflect.DeepEqual(conv.LastUsage(), tt.usage) {
+				t.Errorf("usage = %v, want %v", conv.LastUsage(), tt.usage)
+			}
+			if tt.output == "json" {
+				if lines := strings.Count(w.String(), "\n"); lines != len(tt.chunks) {
+					t.Errorf("json output has %d lines, want one per chunk: %q", lines, w.String())
+				}
+			} else if w.String() != tt.want {
+				t.Errorf("output = %q, want %q", w.String(), tt.want)
+			}
+			if !strings.Contains(logs.String(), tt.logged) {
+				t.Errorf("log = %q, want %q", logs.String(), tt.logged)
+			}
+		})
+	}
+}
+
+func TestMetaErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		transient bool
+	}{
+		{"rate limited", http.StatusTooManyRequests, `{"error":{"code":429,"message":"Quota exceeded","status":"RESOURCE_EXHAUSTED"}}`, true},
+		{"unavailable", http.StatusServiceUnavailable, `{"error":{"code":503,"message":"The service is unavailable"}}`, true},
+		{"invalid request", http.StatusBadRequest, `{"error":{"code":400,"message":"Invalid model","status":"INVALID_ARGUMENT"}}`, false},
+		{"not found", http.StatusNotFound, "Not Found", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestMetaClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprintln(w, tt.body)
+			}, Config{LogType: "none"})
+
+			conv := NewConversation("hi")
+			err := c.GenerateChat(context.Background(), io.Discard, conv, GenerationParameters{})
+			var httpErr *HTTPError
+			if !errors.As(err, &httpErr) {
+				t.Fatalf("error = %v, want an HTTPError", err)
+			}
+			if httpErr.StatusCode != tt.status || httpErr.Body != tt.body {
+				t.Errorf("HTTPError = %d %q, want %d %q", httpErr.StatusCode, httpErr.Body, tt.status, tt.body)
+			}
+			if IsTransient(err) != tt.transient {
+				t.Errorf("IsTransient = %v, want %v", IsTransient(err), tt.transient)
+			}
+			if len(conv.Messages) != 1 {
+				t.Errorf("conversation has %d messages after an error, want the prompt only", len(conv.Messages))
+			}
+		})
+	}
+}
+
+func TestMetaToolsRefused(t *testing.T) {
+	c := newTestMetaClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request sent with tools")
+	}, Config{})
+	err := c.GenerateChat(context.Background(), io.Discard, NewConversation("hi"), GenerationParameters{Tools: []Tool{{Name: "t"}}})
+	if err == nil || !strings.Contains(err.Error(), "tools aren't supported") {
+		t.Errorf("error = %v, want tools aren't supported", err)
+	}
+}
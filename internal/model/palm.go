@@ -9,24 +9,51 @@ import (
 
 	"cloud.google.com/go/aiplatform/apiv1"
 	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
+	"google.golang.org/api/option"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
 // PaLMClient is a client for the PaLM model.
 type PaLMClient struct {
-	client *aiplatform.PredictionClient
-	cfg    Config
+	client    *aiplatform.PredictionClient
+	modelName string
+	cfg       Config
+}
+
+// Close closes the connection to the api.
+func (c *PaLMClient) Close() error {
+	return c.client.Close()
 }
 
 // GenerateContent generates content from the PaLM model.
-func (c *PaLMClient) GenerateContent(ctx context.Context, w io.Writer, prompt string, parameters map[string]interface{}) error {
+func (c *PaLMClient) GenerateContent(ctx context.Context, w io.Writer, prompt string, params GenerationParameters) error {
+	return c.GenerateChat(ctx, w, NewConversation(prompt), params)
+}
+
+// GenerateChat generates the next turn of a conversation from the PaLM model.
+// The text model has no chat api, so the conversation is sent as a transcript.
+func (c *PaLMClient) GenerateChat(ctx context.Context, w io.Writer, conv *Conversation, params GenerationParameters) error {
+	if len(params.Tools) > 0 {
+		return fmt.Errorf("tools aren't supported for PaLM models, use a Gemini or Claude model")
+	}
 	// Endpoint
-	base := fmt.Sprintf("projects/%s/locations/%s/publishers/%s/models", c.cfg.ProjectID, c.cfg.RegionID, "google")
-	url := fmt.Sprintf("%s/%s", base, "text-bison")
+	url := c.endpoint()
 	if c.cfg.LogType != "none" {
 		log.Printf("url: %s", url)
 	}
+
+	// structured output is requested with instructions ahead of the prompt
+	request := conv
+	if params.ResponseSchema != nil {
+		withSchema := *conv
+		withSchema.System = schemaInstructions(conv.System, params.ResponseSchema)
+		request = &withSchema
+	}
+	prompt, err := request.Transcript()
+	if err != nil {
+		return err
+	}
 	// Instances: the prompt to use with the text model
 	promptValue, err := structpb.NewValue(map[string]interface{}{
 		"prompt": prompt,
@@ -36,7 +63,7 @@ func (c *PaLMClient) GenerateContent(ctx context.Context, w io.Writer, prompt st
 	}
 
 	// Parameters: the model configuration parameters
-	parametersValue, err := structpb.NewValue(parameters)
+	parametersValue, err := structpb.NewValue(palmParameters(params))
 	if err != nil {
 		return fmt.Errorf("unable to convert parameters to Value: %v", err)
 	}
@@ -51,22 +78,97 @@ func (c *PaLMClient) GenerateContent(ctx context.Context, w io.Writer, prompt st
 	// PredictResponse: receive the response from the model
 	resp, err := c.client.Predict(ctx, req)
 	if err != nil {
-		return fmt.Errorf("error in prediction: %v", err)
+		return fmt.Errorf("error in prediction: %w", err)
+	}
+
+	var r PaLMResponse
+	structbytes, _ := protojson.Marshal(resp)
+	err = json.Unmarshal(structbytes, &r)
+	if err != nil {
+		return fmt.Errorf("unable to convert to struct: %v", err)
+	}
+	// without a reply, the conversation would end with the user's turn, so it's an error for the caller to drop
+	if len(r.Predictions) == 0 {
+		return fmt.Errorf("error in prediction: no predictions in the response")
 	}
+	tokens := r.Metadata.TokenMetadata
+	conv.addReply(r.Predictions[0].Content, &Usage{
+		InputTokens:  tokens.InputTokenCount.TotalTokens,
+		OutputTokens: tokens.OutputTokenCount.TotalTokens,
+	})
 
 	if c.cfg.OutputType == "json" {
 		rb, _ := json.MarshalIndent(resp, "", "  ")
 		fmt.Fprintln(w, string(rb))
 	} else {
-		if len(resp.Predictions) > 0 {
-			var r PaLMResponse
-			structbytes, _ := protojson.Marshal(resp)
-			err := json.Unmarshal(structbytes, &r)
-			if err != nil {
-				return fmt.Errorf("unable to convert to struct: %v", err)
-			}
-			fmt.Fprintf(w, "%v", r.Predictions[0].Content)
-		}
+		fmt.Fprintf(w, "%v", r.Predictions[0].Content)
 	}
 	return nil
 }
+
+// palmParameters maps generation parameters to PaLM text model parameters.
+func palmParameters(params GenerationParameters) map[string]interface{} {
+	parameters := map[string]interface{}{}
+	for k, v := range params.Extra {
+		parameters[k] = v
+	}
+	if params.Temperature != nil {
+		parameters["temperature"] = float64(*params.Temperature)
+	}
+	if params.TopP != nil {
+		parameters["topP"] = float64(*params.TopP)
+	}
+	if params.TopK != nil {
+		parameters["topK"] = float64(*params.TopK)
+	}
+	if params.MaxOutputTokens > 0 {
+		parameters["maxOutputTokens"] = float64(params.MaxOutputTokens)
+	}
+	if len(params.StopSequences) > 0 {
+		stop := make([]interface{}, 0, len(params.StopSequences))
+		for _, s := range params.StopSequences {
+			stop = append(stop, s)
+		}
+		parameters["stopSequences"] = stop
+	}
+	if params.Seed != nil {
+		parameters["seed"] = float64(*params.Seed)
+	}
+	return parameters
+}
+
+// CountTokens counts the tokens in a conversation with the PaLM model's tokenizer.
+func (c *PaLMClient) CountTokens(ctx context.Context, conv *Conversation) (TokenCount, error) {
+	prompt, err := conv.Transcript()
+	if err != nil {
+		return TokenCount{}, err
+	}
+	promptValue, err := structpb.NewValue(map[string]interface{}{
+		"prompt": prompt,
+	})
+	if err != nil {
+		return TokenCount{}, fmt.Errorf("unable to convert prompt to Value: %v", err)
+	}
+
+	// token counting is served by the LLM utility service
+	apiEndpoint := fmt.Sprintf("%s-aiplatform.googleapis.com:443", c.cfg.RegionID)
+	utility, err := aiplatform.NewLlmUtilityClient(ctx, option.WithEndpoint(apiEndpoint))
+	if err != nil {
+		return TokenCount{}, fmt.Errorf("unable to create llm utility client: %v", err)
+	}
+	defer utility.Close()
+
+	resp, err := utility.CountTokens(ctx, &aiplatformpb.CountTokensRequest{
+		Endpoint:  c.endpoint(),
+		Instances: []*structpb.Value{promptValue},
+	})
+	if err != nil {
+		return TokenCount{}, fmt.Errorf("error counting tokens: %v", err)
+	}
+	return TokenCount{Model: c.modelName, TotalTokens: int(resp.TotalTokens)}, nil
+}
+
+// endpoint returns the publisher model resource for the PaLM model.
+func (c *PaLMClient) endpoint() string {
+	return fmt.Sprintf("projects/%s/locations/%s/publishers/google/models/%s", c.cfg.ProjectID, c.cfg.RegionID, c.modelName)
+}
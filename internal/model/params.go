@@ -0,0 +1,132 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DefaultMaxOutputTokens is used for model families that require an output token limit when none is configured.
+const DefaultMaxOutputTokens = 1024
+
+// GenerationParameters are the model parameters common to every model family.
+// Each client maps them to its provider's native request fields.
+type GenerationParameters struct {
+	Temperature     *float32 `json:"temperature,omitempty"`
+	TopP            *float32 `json:"topP,omitempty"`
+	TopK            *float32 `json:"topK,omitempty"`
+	MaxOutputTokens int32    `json:"maxOutputTokens,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+	Seed            *int32   `json:"seed,omitempty"`
+	// ResponseSchema constrains the output to JSON conforming to a JSON Schema.
+	ResponseSchema Schema `json:"-"`
+	// Tools are the functions the model can call, for model families with function calling.
+	Tools []Tool `json:"-"`
+	// Extra holds provider-specific parameters, passed through to the request as-is.
+	Extra map[string]interface{} `json:"-"`
+}
+
+// parameterAliases maps the provider spellings of the common parameters to their normalized names.
+var parameterAliases = map[string]string{
+	"temperature":          "temperature",
+	"topP":                 "topP",
+	"top_p":                "topP",
+	"topK":                 "topK",
+	"top_k":                "topK",
+	"maxOutputTokens":      "maxOutputTokens",
+	"max_output_tokens":    "maxOutputTokens",
+	"max_tokens":           "maxOutputTokens",
+	"max_tokens_to_sample": "maxOutputTokens",
+	"stopSequences":        "stopSequences",
+	"stop_sequences":       "stopSequences",
+	"stop":                 "stopSequences",
+	"seed":                 "seed",
+}
+
+// ParseGenerationParameters parses a JSON object of model parameters.
+// Common parameters are accepted in camelCase or snake_case; anything else is kept in Extra.
+func ParseGenerationParameters(data []byte) (GenerationParameters, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return GenerationParameters{}, err
+	}
+
+	normalized := map[string]json.RawMessage{}
+	extra := map[string]interface{}{}
+	for k, v := range raw {
+		if name, ok := parameterAliases[k]; ok {
+			normalized[name] = v
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(v, &value); err != nil {
+			return GenerationParameters{}, fmt.Errorf("parameter %s: %v", k, err)
+		}
+		extra[k] = value
+	}
+
+	// a single stop sequence may be given as a string
+	if stop, ok := normalized["stopSequences"]; ok {
+		var s string
+		if json.Unmarshal(stop, &s) == nil {
+			normalized["stopSequences"], _ = json.Marshal([]string{s})
+		}
+	}
+
+	var params parameters
+	data, _ = json.Marshal(normalized)
+	if err := json.Unmarshal(data, &params); err != nil {
+		return GenerationParameters{}, err
+	}
+	if len(extra) > 0 {
+		params.Extra = extra
+	}
+	return GenerationParameters(params), nil
+}
+
+// parameters has the fields of GenerationParameters, without its JSON methods.
+type parameters GenerationParameters
+
+// MarshalJSON marshals the parameters with the extra parameters inlined, as they're parsed.
+func (p GenerationParameters) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(parameters(p))
+	if err != nil {
+		return nil, err
+	}
+	return mergeExtra(data, p.Extra)
+}
+
+// UnmarshalJSON parses the parameters with ParseGenerationParameters.
+func (p *GenerationParameters) UnmarshalJSON(data []byte) error {
+	params, err := ParseGenerationParameters(data)
+	if err != nil {
+		return err
+	}
+	*p = params
+	return nil
+}
+
+// maxOutputTokens returns the configured output token limit, or the default.
+func (p GenerationParameters) maxOutputTokens() int {
+	if p.MaxOutputTokens > 0 {
+		return int(p.MaxOutputTokens)
+	}
+	return DefaultMaxOutputTokens
+}
+
+// mergeExtra adds the provider-specific parameters to a marshalled JSON request,
+// without overriding the fields already set.
+func mergeExtra(data []byte, extra map[string]interface{}) ([]byte, error) {
+	if len(extra) == 0 {
+		return data, nil
+	}
+	var request map[string]interface{}
+	if err := json.Unmarshal(data, &request); err != nil {
+		return nil, err
+	}
+	for k, v := range extra {
+		if _, ok := request[k]; !ok {
+			request[k] = v
+		}
+	}
+	return json.Marshal(request)
+}
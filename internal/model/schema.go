@@ -0,0 +1,432 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// Schema is a JSON Schema that constrains a model's structured output.
+type Schema map[string]interface{}
+
+// LoadSchema reads a JSON Schema from a file.
+func LoadSchema(path string) (Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read schema %s: %w", path, err)
+	}
+	var schema Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("error unmarshalling schema %s: %w", path, err)
+	}
+	return schema, nil
+}
+
+// SchemaError lists the ways a model's output doesn't conform to a schema.
+type SchemaError struct {
+	Problems []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("output does not conform to schema:\n  %s", strings.Join(e.Problems, "\n  "))
+}
+
+// Validate checks that the output is JSON conforming to the schema, returning a *SchemaError when it doesn't.
+// Markdown code fences around the JSON are ignored.
+// The type, enum, const, properties, required, additionalProperties, items, anyOf, oneOf, allOf,
+// length, size, range, pattern and local $ref keywords are checked; other keywords are ignored.
+func (s Schema) Validate(output string) error {
+	var value interface{}
+	if err := json.Unmarshal([]byte(trimCodeFence(output)), &value); err != nil {
+		return &SchemaError{Problems: []string{fmt.Sprintf("output is not valid JSON: %v", err)}}
+	}
+	v := schemaValidator{root: s, resolving: map[string]bool{}}
+	v.validate("$", value, map[string]interface{}(s))
+	if len(v.problems) > 0 {
+		return &SchemaError{Problems: v.problems}
+	}
+	return nil
+}
+
+// trimCodeFence removes a markdown code fence wrapped around the output.
+func trimCodeFence(output string) string {
+	output = strings.TrimSpace(output)
+	if !strings.HasPrefix(output, "```") {
+		return output
+	}
+	output = strings.TrimPrefix(output, "```")
+	if i := strings.Index(output, "\n"); i >= 0 {
+		output = output[i+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(output), "```"))
+}
+
+// schemaValidator collects the problems found validating a value against a schema.
+type schemaValidator struct {
+	root     Schema
+	problems []string
+	// resolving holds the references being followed at each path, as $ref can make a schema recursive
+	resolving map[string]bool
+}
+
+func (v *schemaValidator) fail(path, format string, args ...interface{}) {
+	v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *schemaValidator) validate(path string, value interface{}, schema map[string]interface{}) {
+	if ref, ok := schema["$ref"].(string); ok {
+		// a reference followed again without descending into the value, such as anyOf a $ref to itself, never ends
+		key := path + " " + ref
+		if v.resolving[key] {
+			v.fail(path, "recursive $ref %s", ref)
+			return
+		}
+		v.resolving[key] = true
+		defer delete(v.resolving, key)
+		resolved, err := v.resolve(ref)
+		if err != nil {
+			v.fail(path, "%v", err)
+			return
+		}
+		schema = resolved
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(value, t) {
+		v.fail(path, "expected %v, got %s", t, jsonType(value))
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(path, "%v is not one of %v", value, enum)
+		}
+	}
+	if c, ok := schema["const"]; ok && !reflect.DeepEqual(c, value) {
+		v.fail(path, "expected %v, got %v", c, value)
+	}
+
+	for _, sub := range subschemas(schema["allOf"]) {
+		v.validate(path, value, sub)
+	}
+	if anyOf := subschemas(schema["anyOf"]); len(anyOf) > 0 && v.matching(path, value, anyOf) == 0 {
+		v.fail(path, "does not match any schema in anyOf")
+	}
+	if oneOf := subschemas(schema["oneOf"]); len(oneOf) > 0 {
+		if n := v.matching(path, value, oneOf); n != 1 {
+			v.fail(path, "matches %d schemas in oneOf, expected exactly 1", n)
+		}
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(path, val, schema)
+	case []interface{}:
+		v.validateArray(path, val, schema)
+	case string:
+		n := float64(len([]rune(val)))
+		if min, ok := number(schema["minLength"]); ok && n < min {
+			v.fail(path, "length %v is less than minLength %v", n, min)
+		}
+		if max, ok := number(schema["maxLength"]); ok && n > max {
+			v.fail(path, "length %v is greater than maxLength %v", n, max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(val) {
+				v.fail(path, "%q does not match pattern %s", val, pattern)
+			}
+		}
+	case float64:
+		if min, ok := number(schema["minimum"]); ok && val < min {
+			v.fail(path, "%v is less than minimum %v", val, min)
+		}
+		if max, ok := number(schema["maximum"]); ok && val > max {
+			v.fail(path, "%v is greater than maximum %v", val, max)
+		}
+		if min, ok := number(schema["exclusiveMinimum"]); ok && val <= min {
+			v.fail(path, "%v is not greater than exclusiveMinimum %v", val, min)
+		}
+		if max, ok := number(schema["exclusiveMaximum"]); ok && val >= max {
+			v.fail(path, "%v is not less than exclusiveMaximum %v", val, max)
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(path string, obj map[string]interface{}, schema map[string]interface{}) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, ok := obj[name]; !ok {
+				v.fail(path, "missing required property %q", name)
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if prop, ok := properties[name].(map[string]interface{}); ok {
+			v.validate(path+"."+name, obj[name], prop)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.fail(path, "additional property %q is not allowed", name)
+			}
+		case map[string]interface{}:
+			v.validate(path+"."+name, obj[name], additional)
+		}
+	}
+
+	n := float64(len(obj))
+	if min, ok := number(schema["minProperties"]); ok && n < min {
+		v.fail(path, "has %v properties, less than minProperties %v", n, min)
+	}
+	if max, ok := number(schema["maxProperties"]); ok && n > max {
+		v.fail(path, "has %v properties, more than maxProperties %v", n, max)
+	}
+}
+
+func (v *schemaValidator) validateArray(path string, arr []interface{}, schema map[string]interface{}) {
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		for i, item := range arr {
+			v.validate(fmt.Sprintf("%s[%d]", path, i), item, items)
+		}
+	}
+	n := float64(len(arr))
+	if min, ok := number(schema["minItems"]); ok && n < min {
+		v.fail(path, "has %v items, less than minItems %v", n, min)
+	}
+	if max, ok := number(schema["maxItems"]); ok && n > max {
+		v.fail(path, "has %v items, more than maxItems %v", n, max)
+	}
+}
+
+// matching returns how many of the schemas the value conforms to.
+func (v *schemaValidator) matching(path string, value interface{}, schemas []map[string]interface{}) int {
+	n := 0
+	for _, sub := range schemas {
+		check := schemaValidator{root: v.root, resolving: v.resolving}
+		check.validate(path, value, sub)
+		if len(check.problems) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// resolve looks up a local reference such as #/$defs/name in the root schema.
+func (v *schemaValidator) resolve(ref string) (map[string]interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported $ref %s, only local references are supported", ref)
+	}
+	var node interface{} = map[string]interface{}(v.root)
+	for _, part := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(ref, "#"), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolved $ref %s", ref)
+		}
+		node = obj[strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")]
+	}
+	schema, ok := node.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unresolved $ref %s", ref)
+	}
+	return schema, nil
+}
+
+// matchesType reports whether the value is of the schema type, or one of the types.
+func matchesType(value interface{}, t interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		actual := jsonType(value)
+		if t == "integer" {
+			f, ok := value.(float64)
+			return ok && f == math.Trunc(f)
+		}
+		return actual == t
+	case []interface{}:
+		for _, each := range t {
+			if matchesType(value, each) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// jsonType returns the JSON Schema type name of a decoded JSON value.
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func subschemas(v interface{}) []map[string]interface{} {
+	list, _ := v.([]interface{})
+	schemas := make([]map[string]interface{}, 0, len(list))
+	for _, each := range list {
+		if s, ok := each.(map[string]interface{}); ok {
+			schemas = append(schemas, s)
+		}
+	}
+	return schemas
+}
+
+func number(v interface{}) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+// schemaInstructions asks a model without native structured output to respond with conforming JSON.
+func schemaInstructions(system string, schema Schema) string {
+	data, _ := json.Marshal(schema)
+	instructions := fmt.Sprintf("Respond only with a JSON value that conforms to this JSON Schema, without any other text or markdown:\n%s", data)
+	if system == "" {
+		return instructions
+	}
+	return system + "\n\n" + instructions
+}
+
+// geminiSchema converts a JSON Schema to Gemini's OpenAPI-based response schema,
+// resolving local references against the root schema. OpenAPI schemas can't be recursive,
+// so a recursive schema, such as {"type": "array", "items": {"$ref": "#"}}, is an error.
+func geminiSchema(root Schema) (*genai.Schema, error) {
+	c := schemaConverter{root: root, resolving: map[string]bool{}}
+	return c.convert(root)
+}
+
+// schemaConverter converts a schema to Gemini's, keeping the references being resolved to detect cycles.
+type schemaConverter struct {
+	root      Schema
+	resolving map[string]bool
+}
+
+func (c *schemaConverter) convert(schema map[string]interface{}) (*genai.Schema, error) {
+	if ref, ok := schema["$ref"].(string); ok {
+		if c.resolving[ref] {
+			return nil, fmt.Errorf("recursive $ref %s", ref)
+		}
+		v := schemaValidator{root: c.root}
+		if resolved, err := v.resolve(ref); err == nil {
+			c.resolving[ref] = true
+			defer delete(c.resolving, ref)
+			schema = resolved
+		}
+	}
+	s := &genai.Schema{}
+	switch t := schema["type"].(type) {
+	case string:
+		s.Type = genai.Type(strings.ToUpper(t))
+	case []interface{}:
+		// a nullable type is given as [type, "null"]
+		for _, each := range t {
+			name, _ := each.(string)
+			if name == "null" {
+				nullable := true
+				s.Nullable = &nullable
+			} else {
+				s.Type = genai.Type(strings.ToUpper(name))
+			}
+		}
+	}
+	s.Title, _ = schema["title"].(string)
+	s.Description, _ = schema["description"].(string)
+	s.Format, _ = schema["format"].(string)
+	s.Pattern, _ = schema["pattern"].(string)
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		for _, e := range enum {
+			s.Enum = append(s.Enum, fmt.Sprintf("%v", e))
+		}
+		// Gemini enums are strings
+		if s.Type == "" {
+			s.Type = genai.TypeString
+		}
+	}
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		s.Properties = map[string]*genai.Schema{}
+		for name, prop := range properties {
+			if p, ok := prop.(map[string]interface{}); ok {
+				converted, err := c.convert(p)
+				if err != nil {
+					return nil, err
+				}
+				s.Properties[name] = converted
+			}
+		}
+	}
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				s.Required = append(s.Required, name)
+			}
+		}
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		converted, err := c.convert(items)
+		if err != nil {
+			return nil, err
+		}
+		s.Items = converted
+	}
+	for _, sub := range subschemas(schema["anyOf"]) {
+		converted, err := c.convert(sub)
+		if err != nil {
+			return nil, err
+		}
+		s.AnyOf = append(s.AnyOf, converted)
+	}
+	if min, ok := number(schema["minimum"]); ok {
+		s.Minimum = &min
+	}
+	if max, ok := number(schema["maximum"]); ok {
+		s.Maximum = &max
+	}
+	s.MinItems = int64Value(schema["minItems"])
+	s.MaxItems = int64Value(schema["maxItems"])
+	s.MinLength = int64Value(schema["minLength"])
+	s.MaxLength = int64Value(schema["maxLength"])
+	return s, nil
+}
+
+func int64Value(v interface{}) *int64 {
+	f, ok := number(v)
+	if !ok {
+		return nil
+	}
+	i := int64(f)
+	return &i
+}
@@ -0,0 +1,143 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+func mustSchema(t *testing.T, s string) Schema {
+	t.Helper()
+	var schema Schema
+	if err := json.Unmarshal([]byte(s), &schema); err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestGeminiSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		want    *genai.Schema
+		wantErr string
+	}{
+		{
+			name:   "local reference",
+			schema: `{"type":"object","properties":{"name":{"$ref":"#/$defs/name"}},"required":["name"],"$defs":{"name":{"type":"string"}}}`,
+			want: &genai.Schema{
+				Type:       genai.TypeObject,
+				Properties: map[string]*genai.Schema{"name": {Type: genai.TypeString}},
+				Required:   []string{"name"},
+			},
+		},
+		{
+			name:   "reference used twice",
+			schema: `{"type":"array","items":{"anyOf":[{"$ref":"#/$defs/n"},{"$ref":"#/$defs/n"}]},"$defs":{"n":{"type":"number"}}}`,
+			want: &genai.Schema{
+				Type:  genai.TypeArray,
+				Items: &genai.Schema{AnyOf: []*genai.Schema{{Type: genai.TypeNumber}, {Type: genai.TypeNumber}}},
+			},
+		},
+		{
+			name:    "recursive root reference",
+			schema:  `{"type":"array","items":{"$ref":"#"}}`,
+			wantErr: "recursive $ref #",
+		},
+		{
+			name:    "recursive definition",
+			schema:  `{"$ref":"#/$defs/node","$defs":{"node":{"type":"object","properties":{"children":{"type":"array","items":{"$ref":"#/$defs/node"}}}}}}`,
+			wantErr: "recursive $ref #/$defs/node",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := geminiSchema(mustSchema(t, tt.schema))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(tt.want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("schema = %s\nwant %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestGeminiConfigRecursiveSchema(t *testing.T) {
+	recursive := `{"type":"array","items":{"$ref":"#"}}`
+
+	config, err := geminiConfig(GenerationParameters{Tools: []Tool{{Name: "nest", Parameters: mustSchema(t, recursive)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	declaration := config.Tools[0].FunctionDeclarations[0]
+	if declaration.Parameters != nil || declaration.ParametersJsonSchema == nil {
+		t.Errorf("recursive tool parameters = %v, %v, want them sent as JSON Schema", declaration.Parameters, declaration.ParametersJsonSchema)
+	}
+
+	_, err = geminiConfig(GenerationParameters{ResponseSchema: mustSchema(t, recursive)})
+	if err == nil || !strings.Contains(err.Error(), "recursive $ref") {
+		t.Errorf("error = %v, want recursive $ref", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   string
+		output   string
+		problems []string
+	}{
+		{
+			name:   "recursive schema",
+			schema: `{"type":"array","items":{"$ref":"#"}}`,
+			output: "[[], [[]]]",
+		},
+		{
+			name:     "recursive schema with a wrong item",
+			schema:   `{"type":"array","items":{"$ref":"#"}}`,
+			output:   "[[], [1]]",
+			problems: []string{"$[1][0]: expected array, got number"},
+		},
+		{
+			name:   "code fence",
+			schema: `{"type":"object","properties":{"n":{"type":"integer"}},"required":["n"]}`,
+			output: "```json\n{\"n\": 1}\n```",
+		},
+		{
+			name:     "reference cycle without descending",
+			schema:   `{"anyOf":[{"$ref":"#"},{"type":"string"}]}`,
+			output:   "1",
+			problems: []string{"$: does not match any schema in anyOf"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mustSchema(t, tt.schema).Validate(tt.output)
+			if len(tt.problems) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var schemaErr *SchemaError
+			if !errors.As(err, &schemaErr) {
+				t.Fatalf("error = %v, want a SchemaError", err)
+			}
+			if strings.Join(schemaErr.Problems, "\n") != strings.Join(tt.problems, "\n") {
+				t.Errorf("problems = %q, want %q", schemaErr.Problems, tt.problems)
+			}
+		})
+	}
+}
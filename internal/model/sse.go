@@ -0,0 +1,68 @@
+package model
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
+)
+
+// readEvents reads server-sent events, calling fn with the event type and data of each event.
+// Reading stops at the end of the stream or when fn returns an error.
+func readEvents(r io.Reader, fn func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	var event string
+	var data []string
+	dispatch := func() error {
+		defer func() {
+			event = ""
+			data = nil
+		}()
+		if len(data) == 0 {
+			return nil
+		}
+		return fn(event, strings.Join(data, "\n"))
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if err := dispatch(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, ":"):
+			// comment
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return dispatch()
+}
+
+// rawPredictStreamReader reads the http bodies of a StreamRawPredict response as one stream.
+type rawPredictStreamReader struct {
+	stream aiplatformpb.PredictionService_StreamRawPredictClient
+	buf    []byte
+}
+
+func (r *rawPredictStreamReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		body, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = body.GetData()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
@@ -1,12 +1,33 @@
-
 package model
 
+import "encoding/json"
+
 // AnthropicRequest is the request to the Anthropic model.
 type AnthropicRequest struct {
-	AnthropicVersion string             `json:"anthropic_version"`
-	MaxTokens        int                `json:"max_tokens_to_sample"`
-	Stream           bool               `json:"stream"`
-	Messages         []AnthropicMessage `json:"messages"`
+	AnthropicVersion string               `json:"anthropic_version"`
+	System           string               `json:"system,omitempty"`
+	MaxTokens        int                  `json:"max_tokens"`
+	Temperature      *float32             `json:"temperature,omitempty"`
+	TopP             *float32             `json:"top_p,omitempty"`
+	TopK             *int                 `json:"top_k,omitempty"`
+	StopSequences    []string             `json:"stop_sequences,omitempty"`
+	Stream           bool                 `json:"stream"`
+	Messages         []AnthropicMessage   `json:"messages"`
+	Tools            []AnthropicTool      `json:"tools,omitempty"`
+	ToolChoice       *AnthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+// AnthropicTool is a tool the Anthropic model can call.
+type AnthropicTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema Schema `json:"input_schema"`
+}
+
+// AnthropicToolChoice controls how the Anthropic model uses tools.
+type AnthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
 }
 
 // AnthropicMessage is a message to the Anthropic model.
@@ -17,8 +38,24 @@ type AnthropicMessage struct {
 
 // AnthropicContent is the content of a message.
 type AnthropicContent struct {
-	Text string `json:"text"`
-	Type string `json:"type"`
+	Text   string           `json:"text,omitempty"`
+	Type   string           `json:"type"`
+	Source *AnthropicSource `json:"source,omitempty"`
+	// ID, Name and Input are the fields of a tool_use block.
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+	// ToolUseID, Content and IsError are the fields of a tool_result block.
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+}
+
+// AnthropicSource is the inline data of an image or document content block.
+type AnthropicSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
 }
 
 // AnthropicResponse is the response from the Anthropic model.
@@ -27,22 +64,110 @@ type AnthropicResponse struct {
 		Text string `json:"text"`
 		Type string `json:"type"`
 	} `json:"content"`
+	Usage *AnthropicUsage `json:"usage,omitempty"`
+}
+
+// AnthropicStreamEvent is a server-sent event streamed from the Anthropic model.
+type AnthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage AnthropicUsage `json:"usage"`
+	} `json:"message"`
+	Usage AnthropicUsage `json:"usage"`
+	// Index is the position of the content block an event is about.
+	Index        int `json:"index"`
+	ContentBlock struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"content_block"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// AnthropicUsage is the token usage reported by the Anthropic model.
+type AnthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
 }
 
-// LlamaRequest is the request to the Llama model.
+// AnthropicCountTokensRequest is the request to Anthropic's count_tokens api.
+type AnthropicCountTokensRequest struct {
+	Model    string             `json:"model"`
+	System   string             `json:"system,omitempty"`
+	Messages []AnthropicMessage `json:"messages"`
+}
+
+// AnthropicCountTokensResponse is the response from Anthropic's count_tokens api.
+type AnthropicCountTokensResponse struct {
+	InputTokens int `json:"input_tokens"`
+}
+
+// LlamaRequest is the chat completions request to the Llama model.
 type LlamaRequest struct {
-	AnthropicVersion string             `json:"anthropic_version"`
-	MaxTokens        int                `json:"max_tokens_to_sample"`
-	Stream           bool               `json:"stream"`
-	Messages         []AnthropicMessage `json:"messages"`
+	Model         string              `json:"model"`
+	Messages      []LlamaMessage      `json:"messages"`
+	MaxTokens     int                 `json:"max_tokens,omitempty"`
+	Temperature   *float32            `json:"temperature,omitempty"`
+	TopP          *float32            `json:"top_p,omitempty"`
+	Stop          []string            `json:"stop,omitempty"`
+	Seed          *int32              `json:"seed,omitempty"`
+	Stream        bool                `json:"stream"`
+	StreamOptions *LlamaStreamOptions `json:"stream_options,omitempty"`
+}
+
+// LlamaStreamOptions are the options for a streamed Llama response.
+type LlamaStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// LlamaMessage is a chat message to or from the Llama model.
+type LlamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
 }
 
-// LlamaResponse is the response from the Llama model.
+// LlamaResponse is the chat completions response from the Llama model.
 type LlamaResponse struct {
-	Content []struct {
-		Text string `json:"text"`
-		Type string `json:"type"`
-	} `json:"content"`
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index        int          `json:"index"`
+		Message      LlamaMessage `json:"message"`
+		FinishReason string       `json:"finish_reason"`
+	} `json:"choices"`
+	Usage LlamaUsage `json:"usage"`
+}
+
+// LlamaStreamChunk is a chat completions chunk streamed from the Llama model.
+type LlamaStreamChunk struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index        int          `json:"index"`
+		Delta        LlamaMessage `json:"delta"`
+		FinishReason string       `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *LlamaUsage `json:"usage,omitempty"`
+}
+
+// LlamaUsage is the token usage reported by the Llama model.
+type LlamaUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
 
 // PaLMResponse is the response from the PaLM model.
@@ -50,4 +175,14 @@ type PaLMResponse struct {
 	Predictions []struct {
 		Content string `json:"content"`
 	} `json:"predictions"`
+	Metadata struct {
+		TokenMetadata struct {
+			InputTokenCount struct {
+				TotalTokens int `json:"totalTokens"`
+			} `json:"inputTokenCount"`
+			OutputTokenCount struct {
+				TotalTokens int `json:"totalTokens"`
+			} `json:"outputTokenCount"`
+		} `json:"tokenMetadata"`
+	} `json:"metadata"`
 }
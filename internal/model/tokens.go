@@ -0,0 +1,75 @@
+package model
+
+import (
+	"encoding/csv"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// TokenCount is the number of tokens a model counts for a prompt.
+type TokenCount struct {
+	Model       string `json:"model"`
+	TotalTokens int    `json:"totalTokens"`
+	// Estimated is set when the count comes from EstimateTokens rather than the model's tokenizer.
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// charactersPerToken is the rough average length of a token in English text, across model tokenizers.
+const charactersPerToken = 4
+
+// EstimateTokens estimates the number of tokens in a conversation, as about one token per four characters.
+// It's used for model families without a token counting api, and is only an approximation:
+// code, non-English text and attachments can tokenize quite differently.
+func EstimateTokens(conv *Conversation) int {
+	characters := utf8.RuneCountInString(conv.System)
+	for _, m := range conv.Messages {
+		characters += utf8.RuneCountInString(m.Text)
+		for _, a := range m.Attachments {
+			if a.IsText() {
+				characters += utf8.RuneCount(a.Data)
+			}
+		}
+	}
+	return (characters + charactersPerToken - 1) / charactersPerToken
+}
+
+// estimatedTokenCount returns the estimated token count for a conversation.
+func estimatedTokenCount(modelName string, conv *Conversation) TokenCount {
+	return TokenCount{
+		Model:       modelName,
+		TotalTokens: EstimateTokens(conv),
+		Estimated:   true,
+	}
+}
+
+// ContextWindow returns the number of input tokens a model accepts, from the embedded table of context windows,
+// matched by the longest model name prefix. It returns 0 for models not in the table.
+func ContextWindow(modelName string) int {
+	data, err := modelfiles.ReadFile("models.context")
+	if err != nil {
+		return 0
+	}
+	r := csv.NewReader(strings.NewReader(string(data)))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return 0
+	}
+
+	var prefix string
+	var tokens int
+	for _, record := range records {
+		if strings.HasPrefix(record[0], "#") || len(record) < 2 {
+			continue
+		}
+		if strings.HasPrefix(modelName, record[0]) && len(record[0]) > len(prefix) {
+			n, err := strconv.Atoi(record[1])
+			if err != nil {
+				continue
+			}
+			prefix, tokens = record[0], n
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,50 @@
+package model
+
+// Tool is a function the model can call, declared with a JSON Schema of its arguments.
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parameters is the JSON Schema of the arguments object; nil for a tool without arguments.
+	Parameters Schema `json:"parameters,omitempty"`
+}
+
+// ToolCall is a model's request to call a tool.
+type ToolCall struct {
+	// ID identifies the call, to match its result; not every model family sets it.
+	ID   string                 `json:"id,omitempty"`
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args,omitempty"`
+	// Signature is the Gemini thought signature of the call, returned to the model with the conversation.
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// ToolResult is the output of a tool call, sent back to the model.
+type ToolResult struct {
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	// IsError reports that the call failed or was declined, with the reason in Content.
+	IsError bool `json:"isError,omitempty"`
+}
+
+// AddToolResults appends a user message with the results of the model's tool calls.
+func (c *Conversation) AddToolResults(results ...ToolResult) {
+	c.Messages = append(c.Messages, Message{Role: RoleUser, ToolResults: results})
+}
+
+// addToolReply appends a model message with the tool calls requested by the model.
+func (c *Conversation) addToolReply(text string, calls []ToolCall, usage *Usage) {
+	c.Messages = append(c.Messages, Message{Role: RoleModel, Text: text, ToolCalls: calls, Usage: usage})
+}
+
+// PendingToolCalls returns the tool calls requested in the last message, if it's a model message.
+func (c *Conversation) PendingToolCalls() []ToolCall {
+	if len(c.Messages) == 0 {
+		return nil
+	}
+	last := c.Messages[len(c.Messages)-1]
+	if last.Role != RoleModel {
+		return nil
+	}
+	return last.ToolCalls
+}
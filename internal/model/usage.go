@@ -0,0 +1,91 @@
+package model
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Usage is the number of tokens used by a generation, as reported by the model.
+type Usage struct {
+	InputTokens  int `json:"inputTokens"`
+	OutputTokens int `json:"outputTokens"`
+	// CachedTokens are the input tokens served from a context cache, a subset of InputTokens.
+	CachedTokens int `json:"cachedTokens,omitempty"`
+}
+
+// Add returns the sum of two usages.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		InputTokens:  u.InputTokens + other.InputTokens,
+		OutputTokens: u.OutputTokens + other.OutputTokens,
+		CachedTokens: u.CachedTokens + other.CachedTokens,
+	}
+}
+
+// Price is the estimated cost of a model in USD per million tokens.
+type Price struct {
+	Model       string  `json:"model" mapstructure:"model"`
+	Input       float64 `json:"input" mapstructure:"input"`
+	Output      float64 `json:"output" mapstructure:"output"`
+	CachedInput float64 `json:"cachedInput" mapstructure:"cachedInput"`
+}
+
+// Cost returns the estimated cost in USD of the usage.
+func (p Price) Cost(u Usage) float64 {
+	uncached := u.InputTokens - u.CachedTokens
+	return (float64(uncached)*p.Input + float64(u.CachedTokens)*p.CachedInput + float64(u.OutputTokens)*p.Output) / 1e6
+}
+
+// listToPrices returns the prices from the embedded CSV file of model pricing.
+func listToPrices() ([]Price, error) {
+	data, err := modelfiles.ReadFile("models.pricing")
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(strings.NewReader(string(data)))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading model pricing: %v", err)
+	}
+
+	prices := make([]Price, 0, len(records))
+	for _, record := range records {
+		if strings.HasPrefix(record[0], "#") || len(record) < 4 {
+			continue
+		}
+		price := Price{Model: record[0]}
+		for i, v := range []*float64{&price.Input, &price.Output, &price.CachedInput} {
+			*v, err = strconv.ParseFloat(record[i+1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("error reading price for %s: %v", record[0], err)
+			}
+		}
+		prices = append(prices, price)
+	}
+	return prices, nil
+}
+
+// GetPrice returns the price of a model, from the overrides or the embedded pricing table.
+// Prices are matched by the longest model name prefix, so versioned models share a price.
+func GetPrice(modelName string, overrides []Price) (Price, error) {
+	prices, err := listToPrices()
+	if err != nil {
+		return Price{}, err
+	}
+	// overrides take precedence over embedded prices with the same prefix length
+	prices = append(append([]Price{}, overrides...), prices...)
+
+	var found Price
+	for _, price := range prices {
+		if strings.HasPrefix(modelName, price.Model) && len(price.Model) > len(found.Model) {
+			found = price
+		}
+	}
+	if found.Model == "" {
+		return Price{}, fmt.Errorf("no pricing for model %s", modelName)
+	}
+	return found, nil
+}
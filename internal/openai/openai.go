@@ -0,0 +1,173 @@
+// Package openai serves gen's models with the OpenAI chat completions, embeddings and models apis,
+// translating each request to the model family's client.
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ChatCompletionRequest is a request to /v1/chat/completions.
+type ChatCompletionRequest struct {
+	Model               string         `json:"model"`
+	Messages            []ChatMessage  `json:"messages"`
+	Temperature         *float32       `json:"temperature,omitempty"`
+	TopP                *float32       `json:"top_p,omitempty"`
+	MaxTokens           int32          `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int32          `json:"max_completion_tokens,omitempty"`
+	Stop                StringList     `json:"stop,omitempty"`
+	Seed                *int32         `json:"seed,omitempty"`
+	Stream              bool           `json:"stream,omitempty"`
+	StreamOptions       *StreamOptions `json:"stream_options,omitempty"`
+	ResponseFormat      *struct {
+		Type       string `json:"type"`
+		JSONSchema *struct {
+			Name   string                 `json:"name"`
+			Schema map[string]interface{} `json:"schema"`
+		} `json:"json_schema,omitempty"`
+	} `json:"response_format,omitempty"`
+	Tools []json.RawMessage `json:"tools,omitempty"`
+}
+
+// StreamOptions are the options of a streamed chat completion.
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ChatMessage is a message of a chat completion request; its content is a string or a list of parts.
+type ChatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// ContentPart is a part of a message's content, text or an image.
+type ContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url,omitempty"`
+}
+
+// StringList is a string or a list of strings.
+type StringList []string
+
+// UnmarshalJSON reads a string or a list of strings.
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = StringList{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("expected a string or a list of strings")
+	}
+	*l = list
+	return nil
+}
+
+// ChatCompletion is the response to a chat completion request.
+type ChatCompletion struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []ChatChoice `json:"choices"`
+	Usage   *Usage       `json:"usage,omitempty"`
+}
+
+// ChatChoice is a generated message, or in a stream, a delta of the message.
+type ChatChoice struct {
+	Index        int        `json:"index"`
+	Message      *ChatReply `json:"message,omitempty"`
+	Delta        *ChatReply `json:"delta,omitempty"`
+	FinishReason *string    `json:"finish_reason"`
+}
+
+// ChatReply is the model's message in a chat completion.
+type ChatReply struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// Usage is the token usage of a request.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// EmbeddingRequest is a request to /v1/embeddings.
+type EmbeddingRequest struct {
+	Model          string     `json:"model"`
+	Input          StringList `json:"input"`
+	Dimensions     int32      `json:"dimensions,omitempty"`
+	EncodingFormat string     `json:"encoding_format,omitempty"`
+}
+
+// EmbeddingList is the response to an embeddings request.
+type EmbeddingList struct {
+	Object string          `json:"object"`
+	Data   []EmbeddingData `json:"data"`
+	Model  string          `json:"model"`
+	Usage  Usage           `json:"usage"`
+}
+
+// EmbeddingData is the embedding of one input.
+type EmbeddingData struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// ModelList is the response to /v1/models.
+type ModelList struct {
+	Object string      `json:"object"`
+	Data   []ModelInfo `json:"data"`
+}
+
+// ModelInfo describes a model of the catalog.
+type ModelInfo struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// ErrorResponse is the body of an error response.
+type ErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    string `json:"code,omitempty"`
+	} `json:"error"`
+}
+
+// parts returns the parts of a message's content; an assistant message that only calls tools has none.
+func (m ChatMessage) parts() ([]ContentPart, error) {
+	if len(m.Content) == 0 || string(m.Content) == "null" {
+		return nil, nil
+	}
+	var s string
+	if err := json.Unmarshal(m.Content, &s); err == nil {
+		return []ContentPart{{Type: "text", Text: s}}, nil
+	}
+	var parts []ContentPart
+	if err := json.Unmarshal(m.Content, &parts); err != nil {
+		return nil, fmt.Errorf("message content must be a string or a list of parts")
+	}
+	return parts, nil
+}
+
+// joinText returns the text of the parts.
+func joinText(parts []ContentPart) string {
+	texts := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,386 @@
+package openai
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ghchinoy/gen/internal/model"
+)
+
+// Server serves the OpenAI apis with gen's model clients, created once for each model requested.
+type Server struct {
+	cfg model.Config
+	// Aliases maps model aliases, such as those of gen.yaml, to the models they stand for.
+	Aliases map[string]string
+	// Defaults returns the parameters and system instructions a model is prompted with,
+	// unless the request sets them, such as the model's defaults in gen.yaml.
+	Defaults func(modelName string) (model.GenerationParameters, string, error)
+	// OnReply is called after each chat completion, such as to log it.
+	OnReply func(modelName string, params model.GenerationParameters, conv *model.Conversation, latency time.Duration)
+
+	clients *model.Clients
+}
+
+// NewServer returns a server for the models of the configured project.
+func NewServer(cfg model.Config) *Server {
+	// the clients' output is collected into responses, so it must be the model's text
+	cfg.OutputType = "text"
+	return &Server{cfg: cfg, clients: model.NewClients(cfg)}
+}
+
+// Close closes the model clients, once the server has stopped serving requests.
+func (s *Server) Close() error {
+	return s.clients.Close()
+}
+
+// Handler returns the handler of the /v1/chat/completions, /v1/embeddings and /v1/models endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", s.chatCompletions)
+	mux.HandleFunc("POST /v1/embeddings", s.embeddings)
+	mux.HandleFunc("GET /v1/models", s.models)
+	return mux
+}
+
+// chatCompletions generates the next message of a conversation, streamed as server-sent events when requested.
+func (s *Server) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %v", err))
+		return
+	}
+	req.Model = s.resolve(req.Model)
+	var defaults model.GenerationParameters
+	var system string
+	if s.Defaults != nil && req.Model != "" {
+		var err error
+		defaults, system, err = s.Defaults(req.Model)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	conv, params, err := conversation(req, defaults, system)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	client, err := s.client(r.Context(), req.Model)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	if s.cfg.LogType != "none" {
+		log.Printf("chat completion: model: %s, messages: %d, stream: %v", req.Model, len(req.Messages), req.Stream)
+	}
+
+	completion := ChatCompletion{ID: "chatcmpl-" + newID(), Created: time.Now().Unix(), Model: req.Model}
+	start := time.Now()
+	if req.Stream {
+		s.stream(w, r.Context(), client, conv, params, completion, req.StreamOptions != nil && req.StreamOptions.IncludeUsage)
+	} else {
+		var output strings.Builder
+		if err := client.GenerateChat(r.Context(), &output, conv, params); err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		completion.Object = "chat.completion"
+		completion.Choices = []ChatChoice{{
+			Message:      &ChatReply{Role: "assistant", Content: conv.Messages[len(conv.Messages)-1].Text},
+			FinishReason: stringPtr("stop"),
+		}}
+		completion.Usage = usage(conv.LastUsage())
+		writeJSON(w, http.StatusOK, completion)
+	}
+	if len(conv.Messages) > 0 && conv.Messages[len(conv.Messages)-1].Role == model.RoleModel && s.OnReply != nil {
+		s.OnReply(req.Model, params, conv, time.Since(start))
+	}
+}
+
+// stream writes the model's output as chat completion chunks, ending with [DONE].
+func (s *Server) stream(w http.ResponseWriter, ctx context.Context, client model.ModelClient, conv *model.Conversation, params model.GenerationParameters,
+	completion ChatCompletion, includeUsage bool) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	completion.Object = "chat.completion.chunk"
+	chunks := &chunkWriter{w: w, completion: completion}
+	chunks.send([]ChatChoice{{Delta: &ChatReply{Role: "assistant"}}}, nil)
+	if err := client.GenerateChat(ctx, chunks, conv, params); err != nil {
+		// the status was already sent, so the error is an event
+		var e ErrorResponse
+		e.Error.Message, e.Error.Type = err.Error(), "api_error"
+		data, _ := json.Marshal(e)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		chunks.flush()
+		return
+	}
+	chunks.send([]ChatChoice{{Delta: &ChatReply{}, FinishReason: stringPtr("stop")}}, nil)
+	if includeUsage {
+		chunks.send([]ChatChoice{}, usage(conv.LastUsage()))
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	chunks.flush()
+}
+
+// chunkWriter sends each write of the model's output as a chat completion chunk.
+type chunkWriter struct {
+	w          http.ResponseWriter
+	completion ChatCompletion
+}
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := c.send([]ChatChoice{{Delta: &ChatReply{Content: string(p)}}}, nil); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// send writes a chunk as a server-sent event.
+func (c *chunkWriter) send(choices []ChatChoice, u *Usage) error {
+	chunk := c.completion
+	chunk.Choices = choices
+	chunk.Usage = u
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	c.flush()
+	return nil
+}
+
+func (c *chunkWriter) flush() {
+	if f, ok := c.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// conversation translates a chat completion request to a conversation and generation parameters,
+// the parameters and system messages of the request overriding the defaults.
+func conversation(req ChatCompletionRequest, params model.GenerationParameters, defaultSystem string) (*model.Conversation, model.GenerationParameters, error) {
+	if req.Model == "" {
+		return nil, params, fmt.Errorf("missing model")
+	}
+	if len(req.Tools) > 0 {
+		return nil, params, fmt.Errorf("tools aren't supported")
+	}
+
+	conv := &model.Conversation{}
+	var system []string
+	for _, m := range req.Messages {
+		parts, err := m.parts()
+		if err != nil {
+			return nil, params, err
+		}
+		switch m.Role {
+		case "system", "developer":
+			system = append(system, joinText(parts))
+		case "user":
+			var attachments []model.Attachment
+			for _, p := range parts {
+				if p.Type != "image_url" || p.ImageURL == nil {
+					continue
+				}
+				a, err := dataURLAttachment(p.ImageURL.URL)
+				if err != nil {
+					return nil, params, err
+				}
+				attachments = append(attachments, a)
+			}
+			conv.AddUser(joinText(parts), attachments...)
+		case "assistant":
+			// an assistant message without text, such as one with content null, adds nothing to the conversation
+			if text := joinText(parts); text != "" {
+				conv.AddModel(text)
+			}
+		default:
+			return nil, params, fmt.Errorf("messages with the %s role aren't supported", m.Role)
+		}
+	}
+	if len(conv.Messages) == 0 || conv.Messages[len(conv.Messages)-1].Role != model.RoleUser {
+		return nil, params, fmt.Errorf("the last message must be a user message")
+	}
+	conv.System = defaultSystem
+	if len(system) > 0 {
+		conv.System = strings.Join(system, "\n\n")
+	}
+
+	if req.Temperature != nil {
+		params.Temperature = req.Temperature
+	}
+	if req.TopP != nil {
+		params.TopP = req.TopP
+	}
+	if req.MaxTokens > 0 {
+		params.MaxOutputTokens = req.MaxTokens
+	}
+	if req.MaxCompletionTokens > 0 {
+		params.MaxOutputTokens = req.MaxCompletionTokens
+	}
+	if len(req.Stop) > 0 {
+		params.StopSequences = req.Stop
+	}
+	if req.Seed != nil {
+		params.Seed = req.Seed
+	}
+	if f := req.ResponseFormat; f != nil && f.Type == "json_schema" && f.JSONSchema != nil {
+		params.ResponseSchema = model.Schema(f.JSONSchema.Schema)
+	}
+	return conv, params, nil
+}
+
+// dataURLAttachment decodes an image sent as a base64 data URL; images aren't fetched from other URLs.
+func dataURLAttachment(url string) (model.Attachment, error) {
+	header, data, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	if !strings.HasPrefix(url, "data:") || !ok || !strings.HasSuffix(header, ";base64") {
+		return model.Attachment{}, fmt.Errorf("images must be base64 data URLs")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return model.Attachment{}, fmt.Errorf("invalid image data: %v", err)
+	}
+	return model.Attachment{Name: "image", MIMEType: strings.TrimSuffix(header, ";base64"), Data: decoded}, nil
+}
+
+// embeddings embeds the inputs with an embedding model.
+func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
+	var req EmbeddingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %v", err))
+		return
+	}
+	if len(req.Input) == 0 {
+		writeError(w, http.StatusBadRequest, "missing input")
+		return
+	}
+	if req.EncodingFormat != "" && req.EncodingFormat != "float" {
+		writeError(w, http.StatusBadRequest, "only the float encoding format is supported")
+		return
+	}
+	req.Model = s.resolve(req.Model)
+	if req.Model == "" {
+		req.Model = "text-embedding-005"
+	}
+	client, err := s.embedder(r.Context(), req.Model)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	embeddings, err := client.Embed(r.Context(), req.Input, model.EmbedOptions{Dimensionality: req.Dimensions})
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	list := EmbeddingList{Object: "list", Data: make([]EmbeddingData, 0, len(embeddings)), Model: req.Model}
+	for i, e := range embeddings {
+		list.Data = append(list.Data, EmbeddingData{Object: "embedding", Index: i, Embedding: e.Values})
+		list.Usage.PromptTokens += e.Tokens
+	}
+	list.Usage.TotalTokens = list.Usage.PromptTokens
+	writeJSON(w, http.StatusOK, list)
+}
+
+// models lists the models of gen's catalog.
+func (s *Server) models(w http.ResponseWriter, r *http.Request) {
+	models, err := model.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	list := ModelList{Object: "list", Data: make([]ModelInfo, 0, len(models))}
+	for _, m := range models {
+		list.Data = append(list.Data, ModelInfo{ID: m.Name, Object: "model", OwnedBy: m.Family})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// resolve returns the model an alias stands for, or the name itself.
+func (s *Server) resolve(name string) string {
+	if target, ok := s.Aliases[name]; ok {
+		return target
+	}
+	return name
+}
+
+// client returns the model client for a model, creating it on first use.
+func (s *Server) client(ctx context.Context, modelName string) (model.ModelClient, error) {
+	c, err := s.clients.Client(ctx, modelName)
+	if err != nil {
+		return nil, fmt.Errorf("error creating client: %w", err)
+	}
+	return c, nil
+}
+
+// embedder returns the embedding client for a model, creating it on first use.
+func (s *Server) embedder(ctx context.Context, modelName string) (model.EmbeddingClient, error) {
+	c, err := s.clients.Embedder(ctx, modelName)
+	if err != nil {
+		return nil, fmt.Errorf("error creating client: %w", err)
+	}
+	return c, nil
+}
+
+// usage converts a model's usage, if reported.
+func usage(u *model.Usage) *Usage {
+	if u == nil {
+		return nil
+	}
+	return &Usage{PromptTokens: u.InputTokens, CompletionTokens: u.OutputTokens, TotalTokens: u.InputTokens + u.OutputTokens}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	var e ErrorResponse
+	e.Error.Message = message
+	e.Error.Type = "invalid_request_error"
+	if status >= 500 {
+		e.Error.Type = "api_error"
+	}
+	if status == http.StatusNotFound {
+		e.Error.Code = "model_not_found"
+	}
+	writeJSON(w, status, e)
+}
+
+// writeClientError reports a model gen has no client for as not found, and other failures to create one,
+// such as missing credentials, as server errors.
+func writeClientError(w http.ResponseWriter, err error) {
+	if errors.Is(err, model.ErrUnknownModel) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+// newID returns a random id for a completion.
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,155 @@
+package openai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ghchinoy/gen/internal/model"
+)
+
+func TestConversation(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages string
+		want     []model.Message
+		system   string
+		wantErr  string
+	}{
+		{
+			name:     "system and user",
+			messages: `[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]`,
+			want:     []model.Message{{Role: model.RoleUser, Text: "hi"}},
+			system:   "be brief",
+		},
+		{
+			name:     "content parts",
+			messages: `[{"role":"user","content":[{"type":"text","text":"hi"},{"type":"text","text":"there"}]}]`,
+			want:     []model.Message{{Role: model.RoleUser, Text: "hi\nthere"}},
+		},
+		{
+			name:     "assistant content null",
+			messages: `[{"role":"user","content":"hi"},{"role":"assistant","content":null},{"role":"user","content":"again"}]`,
+			want:     []model.Message{{Role: model.RoleUser, Text: "hi"}, {Role: model.RoleUser, Text: "again"}},
+		},
+		{
+			name:     "assistant content missing",
+			messages: `[{"role":"user","content":"hi"},{"role":"assistant"},{"role":"assistant","content":"hello"},{"role":"user","content":"again"}]`,
+			want:     []model.Message{{Role: model.RoleUser, Text: "hi"}, {Role: model.RoleModel, Text: "hello"}, {Role: model.RoleUser, Text: "again"}},
+		},
+		{
+			name:     "invalid content",
+			messages: `[{"role":"user","content":42}]`,
+			wantErr:  "message content must be a string or a list of parts",
+		},
+		{
+			name:     "last message from the assistant",
+			messages: `[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"}]`,
+			wantErr:  "the last message must be a user message",
+		},
+		{
+			name:     "unsupported role",
+			messages: `[{"role":"tool","content":"42"},{"role":"user","content":"hi"}]`,
+			wantErr:  "messages with the tool role aren't supported",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ChatCompletionRequest{Model: "gemini-2.5-flash"}
+			if err := json.Unmarshal([]byte(tt.messages), &req.Messages); err != nil {
+				t.Fatal(err)
+			}
+			conv, _, err := conversation(req, model.GenerationParameters{}, "")
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(conv.Messages) != len(tt.want) {
+				t.Fatalf("conversation has %d messages, want %d", len(conv.Messages), len(tt.want))
+			}
+			for i, m := range conv.Messages {
+				if m.Role != tt.want[i].Role || m.Text != tt.want[i].Text {
+					t.Errorf("message %d = %s %q, want %s %q", i, m.Role, m.Text, tt.want[i].Role, tt.want[i].Text)
+				}
+			}
+			if conv.System != tt.system {
+				t.Errorf("system = %q, want %q", conv.System, tt.system)
+			}
+		})
+	}
+}
+
+func TestConversationDefaults(t *testing.T) {
+	temperature, topP := float32(0.2), float32(0.9)
+	defaults := model.GenerationParameters{Temperature: &temperature, TopP: &topP, MaxOutputTokens: 1024}
+
+	var req ChatCompletionRequest
+	if err := json.Unmarshal([]byte(`{"model":"gemini-2.5-flash","temperature":1,"messages":[{"role":"user","content":"hi"}]}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	conv, params, err := conversation(req, defaults, "be brief")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conv.System != "be brief" {
+		t.Errorf("system = %q, want the default", conv.System)
+	}
+	if *params.Temperature != 1 || *params.TopP != topP || params.MaxOutputTokens != 1024 {
+		t.Errorf("parameters = %v %v %d, want the request's temperature and the default top_p and max tokens", *params.Temperature, *params.TopP, params.MaxOutputTokens)
+	}
+
+	req.Messages = append([]ChatMessage{{Role: "system", Content: json.RawMessage(`"be thorough"`)}}, req.Messages...)
+	conv, _, err = conversation(req, defaults, "be brief")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conv.System != "be thorough" {
+		t.Errorf("system = %q, want the request's", conv.System)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	server := NewServer(model.Config{ProjectID: "my-project", RegionID: "us-central1", LogType: "none"})
+	server.Aliases = map[string]string{"smart": "gpt-4o"}
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+		typ    string
+		code   string
+	}{
+		{"unknown model", "/v1/chat/completions", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`, http.StatusNotFound, "invalid_request_error", "model_not_found"},
+		{"alias of an unknown model", "/v1/chat/completions", `{"model":"smart","messages":[{"role":"user","content":"hi"}]}`, http.StatusNotFound, "invalid_request_error", "model_not_found"},
+		{"missing model", "/v1/chat/completions", `{"messages":[{"role":"user","content":"hi"}]}`, http.StatusBadRequest, "invalid_request_error", ""},
+		{"invalid json", "/v1/chat/completions", `{"model":`, http.StatusBadRequest, "invalid_request_error", ""},
+		{"unknown embedding model", "/v1/embeddings", `{"model":"gpt-4o","input":"hi"}`, http.StatusNotFound, "invalid_request_error", "model_not_found"},
+		{"generative model for embeddings", "/v1/embeddings", `{"model":"gemini-2.5-flash","input":"hi"}`, http.StatusNotFound, "invalid_request_error", "model_not_found"},
+		{"missing input", "/v1/embeddings", `{"model":"text-embedding-005"}`, http.StatusBadRequest, "invalid_request_error", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid error response %q: %v", rec.Body, err)
+			}
+			if resp.Error.Type != tt.typ || resp.Error.Code != tt.code || resp.Error.Message == "" {
+				t.Errorf("error = %+v, want type %s, code %q", resp.Error, tt.typ, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+// Package templates keeps named prompt templates, with Go text/template variables, in the local config directory.
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ghchinoy/gen/internal/model"
+)
+
+// Template is a named prompt, with the model, system instructions and parameters to run it with.
+//
+//	description: Summarize a file
+//	model: gemini-2.5-flash
+//	system: You are a concise technical writer.
+//	parameters:
+//	  temperature: 0.2
+//	variables:
+//	  sentences: "3"
+//	prompt: |
+//	  Summarize {{.file}} in {{.sentences}} sentences.
+//
+//	  {{readFile .file}}
+type Template struct {
+	Name        string                 `yaml:"-" json:"name"`
+	Description string                 `yaml:"description,omitempty" json:"description,omitempty"`
+	Model       string                 `yaml:"model,omitempty" json:"model,omitempty"`
+	System      string                 `yaml:"system,omitempty" json:"system,omitempty"`
+	Parameters  map[string]interface{} `yaml:"parameters,omitempty" json:"parameters,omitempty"`
+	// Variables are the default values of the template's variables.
+	Variables map[string]string `yaml:"variables,omitempty" json:"variables,omitempty"`
+	Prompt    string            `yaml:"prompt" json:"prompt"`
+}
+
+// Example is the template written for a new template to edit.
+const Example = `description: Summarize a file
+# model: gemini-2.5-flash
+# system: You are a concise technical writer.
+# parameters:
+#   temperature: 0.2
+variables:
+  sentences: "3"
+prompt: |
+  Summarize {{.file}} in {{.sentences}} sentences.
+
+  {{readFile .file}}
+`
+
+// funcs are the functions available to templates, besides text/template's own.
+var funcs = template.FuncMap{
+	"readFile": func(path string) (string, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("unable to read file %s: %w", path, err)
+		}
+		return string(data), nil
+	},
+}
+
+// Dir returns the directory templates are kept in, under gen's config directory.
+func Dir(configDir string) string {
+	return filepath.Join(configDir, "templates")
+}
+
+// ValidateName checks that a template name is a file name in the templates directory,
+// without path separators or a leading dot, so it can't name a file elsewhere.
+func ValidateName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") || strings.Contains(name, "..") {
+		return fmt.Errorf("invalid template name %q, use a name without path separators or .., not starting with a dot", name)
+	}
+	return nil
+}
+
+// Path returns the file of a named template, after checking the name.
+func Path(dir, name string) (string, error) {
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".yaml"), nil
+}
+
+// Load reads a named template from a directory.
+func Load(dir, name string) (Template, error) {
+	path, err := Path(dir, name)
+	if err != nil {
+		return Template{}, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Template{}, fmt.Errorf("no template %s in %s", name, dir)
+	}
+	if err != nil {
+		return Template{}, err
+	}
+	t := Template{Name: name}
+	if err := yaml.Unmarshal(data, &t); err != nil {
+		return Template{}, fmt.Errorf("error reading template %s: %w", name, err)
+	}
+	if t.Prompt == "" {
+		return Template{}, fmt.Errorf("template %s has no prompt", name)
+	}
+	return t, nil
+}
+
+// List reads the templates in a directory, by name; a missing directory has no templates.
+func List(dir string) ([]Template, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	list := make([]Template, 0, len(paths))
+	for _, path := range paths {
+		t, err := Load(dir, strings.TrimSuffix(filepath.Base(path), ".yaml"))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, nil
+}
+
+// Render executes the template's prompt and system instructions with its variables,
+// overridden by vars. A variable without a value is an error.
+func (t Template) Render(vars map[string]string) (prompt, system string, err error) {
+	values := map[string]string{}
+	for k, v := range t.Variables {
+		values[k] = v
+	}
+	for k, v := range vars {
+		values[k] = v
+	}
+	prompt, err = t.execute("prompt", t.Prompt, values)
+	if err != nil {
+		return "", "", err
+	}
+	system, err = t.execute("system", t.System, values)
+	if err != nil {
+		return "", "", err
+	}
+	return prompt, system, nil
+}
+
+// execute renders one of the template's texts.
+func (t Template) execute(part, text string, values map[string]string) (string, error) {
+	tmpl, err := template.New(t.Name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("error parsing the %s of template %s: %w", part, t.Name, err)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, values); err != nil {
+		return "", fmt.Errorf("error rendering the %s of template %s: %w", part, t.Name, err)
+	}
+	return b.String(), nil
+}
+
+// GenerationParameters returns the template's model parameters, parsed like a --config file.
+func (t Template) GenerationParameters() (model.GenerationParameters, error) {
+	data, err := json.Marshal(t.Parameters)
+	if err != nil {
+		return model.GenerationParameters{}, err
+	}
+	params, err := model.ParseGenerationParameters(data)
+	if err != nil {
+		return model.GenerationParameters{}, fmt.Errorf("error reading the parameters of template %s: %w", t.Name, err)
+	}
+	return params, nil
+}
+
+// ParseVars parses key=value pairs, as given with -p.
+func ParseVars(pairs []string) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid variable %q, expected key=value", pair)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
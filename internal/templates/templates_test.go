@@ -0,0 +1,175 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"summarize", "review-go", "release_notes.v2"} {
+		if err := ValidateName(name); err != nil {
+			t.Errorf("ValidateName(%q) = %v, want a valid name", name, err)
+		}
+	}
+	for _, name := range []string{"", "../x", "../../x", "a/b", `a\b`, "..", "a..b", ".hidden"} {
+		if err := ValidateName(name); err == nil {
+			t.Errorf("ValidateName(%q) accepted an invalid name", name)
+		}
+	}
+}
+
+func TestLoadOutsideDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "templates")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	// a template outside the templates directory
+	if err := os.WriteFile(filepath.Join(root, "outside.yaml"), []byte("prompt: hi\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir, "../outside"); err == nil {
+		t.Error("loaded a template outside the templates directory")
+	}
+	if _, err := Path(dir, "../outside"); err == nil {
+		t.Error("returned the path of a template outside the templates directory")
+	}
+}
+
+func TestRender(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(file, []byte("some notes"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		tmpl       Template
+		vars       map[string]string
+		wantPrompt string
+		wantSystem string
+		wantErr    string
+	}{
+		{
+			name:       "defaults",
+			tmpl:       Template{Name: "t", Variables: map[string]string{"n": "3"}, Prompt: "in {{.n}} sentences"},
+			wantPrompt: "in 3 sentences",
+		},
+		{
+			name:       "variables override the defaults",
+			tmpl:       Template{Name: "t", Variables: map[string]string{"n": "3"}, Prompt: "in {{.n}} sentences"},
+			vars:       map[string]string{"n": "5"},
+			wantPrompt: "in 5 sentences",
+		},
+		{
+			name:       "system instructions",
+			tmpl:       Template{Name: "t", System: "You write {{.lang}}.", Prompt: "hi"},
+			vars:       map[string]string{"lang": "Go"},
+			wantPrompt: "hi",
+			wantSystem: "You write Go.",
+		},
+		{
+			name:       "readFile",
+			tmpl:       Template{Name: "t", Prompt: "Summarize {{readFile .file}}"},
+			vars:       map[string]string{"file": file},
+			wantPrompt: "Summarize some notes",
+		},
+		{
+			name:    "missing variable",
+			tmpl:    Template{Name: "t", Prompt: "Summarize {{.file}}"},
+			wantErr: `error rendering the prompt of template t: template: t:1:12: executing "t" at <.file>: map has no entry for key "file"`,
+		},
+		{
+			name:    "missing variable in the system instructions",
+			tmpl:    Template{Name: "t", System: "{{.lang}}", Prompt: "hi"},
+			wantErr: "error rendering the system of template t",
+		},
+		{
+			name:    "missing file",
+			tmpl:    Template{Name: "t", Prompt: "{{readFile .file}}"},
+			vars:    map[string]string{"file": filepath.Join(t.TempDir(), "missing.txt")},
+			wantErr: "error rendering the prompt of template t",
+		},
+		{
+			name:    "invalid template",
+			tmpl:    Template{Name: "t", Prompt: "{{.file"},
+			wantErr: "error parsing the prompt of template t",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompt, system, err := tt.tmpl.Render(tt.vars)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if prompt != tt.wantPrompt || system != tt.wantSystem {
+				t.Errorf("rendered %q, %q, want %q, %q", prompt, system, tt.wantPrompt, tt.wantSystem)
+			}
+		})
+	}
+}
+
+func TestParseVars(t *testing.T) {
+	tests := []struct {
+		pairs   []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{pairs: nil, want: map[string]string{}},
+		{pairs: []string{"file=main.go", "n=3"}, want: map[string]string{"file": "main.go", "n": "3"}},
+		{pairs: []string{"query=a=b"}, want: map[string]string{"query": "a=b"}},
+		{pairs: []string{"empty="}, want: map[string]string{"empty": ""}},
+		{pairs: []string{"n=3", "n=5"}, want: map[string]string{"n": "5"}},
+		{pairs: []string{"file"}, wantErr: true},
+		{pairs: []string{"=value"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseVars(tt.pairs)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseVars(%q) accepted invalid variables", tt.pairs)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseVars(%q) = %v", tt.pairs, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseVars(%q) = %v, want %v", tt.pairs, got, tt.want)
+		}
+	}
+}
+
+func TestGenerationParameters(t *testing.T) {
+	tmpl := Template{Name: "t", Parameters: map[string]interface{}{
+		"temperature":    0.2,
+		"max_tokens":     256,
+		"stop":           "END",
+		"thinkingConfig": map[string]interface{}{"thinkingBudget": 0},
+	}}
+	params, err := tmpl.GenerationParameters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Temperature == nil || *params.Temperature != 0.2 || params.MaxOutputTokens != 256 || !reflect.DeepEqual(params.StopSequences, []string{"END"}) {
+		t.Errorf("parameters = %+v, want temperature 0.2, 256 tokens and the END stop sequence", params)
+	}
+	if _, ok := params.Extra["thinkingConfig"]; !ok {
+		t.Errorf("extra = %v, want thinkingConfig", params.Extra)
+	}
+
+	tmpl.Parameters = map[string]interface{}{"temperature": "hot"}
+	if _, err := tmpl.GenerationParameters(); err == nil || !strings.HasPrefix(err.Error(), "error reading the parameters of template t") {
+		t.Errorf("error = %v, want the template's invalid parameters", err)
+	}
+}
@@ -0,0 +1,309 @@
+// Package tools runs the tools a model calls, as local commands or HTTP requests.
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ghchinoy/gen/internal/model"
+)
+
+// DefaultTimeout is how long a tool runs when its definition doesn't set a timeout.
+const DefaultTimeout = 30 * time.Second
+
+// maxOutput is the size of the largest tool output sent back to the model.
+const maxOutput = 64 * 1024
+
+// Tool is a tool the model can call, run locally.
+type Tool interface {
+	// Declaration returns the tool's name, description and arguments schema, as declared to the model.
+	Declaration() model.Tool
+	// Run calls the tool with the model's arguments and returns its output.
+	Run(ctx context.Context, args map[string]interface{}) (string, error)
+}
+
+// Definition is a tool defined in a tools file or gen.yaml, run as a local command or an HTTP request.
+//
+//	tools:
+//	  - name: git_log
+//	    description: Show the latest commits of the current git repository.
+//	    parameters:
+//	      type: object
+//	      properties:
+//	        count: {type: integer, description: number of commits}
+//	      required: [count]
+//	    command: [git, log, --oneline, "-n", "{{.count}}"]
+//	  - name: weather
+//	    description: Get the current weather for a city.
+//	    parameters:
+//	      type: object
+//	      properties:
+//	        city: {type: string}
+//	    http:
+//	      url: "https://wttr.in/{{urlquery .city}}?format=j1"
+//	      method: GET
+type Definition struct {
+	Name        string       `yaml:"name"`
+	Description string       `yaml:"description"`
+	Parameters  model.Schema `yaml:"parameters"`
+	// Command is the program and arguments to run; each argument is a Go template of the call's arguments,
+	// which are also written to the program's stdin as a JSON object.
+	Command []string `yaml:"command"`
+	// HTTP is the endpoint to request, for a tool that isn't a command.
+	HTTP    *Endpoint     `yaml:"http"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Endpoint is the HTTP request of a tool.
+type Endpoint struct {
+	// URL is a Go template of the call's arguments.
+	URL string `yaml:"url"`
+	// Method is POST by default, sending the arguments as a JSON body; with GET, the arguments the URL doesn't
+	// refer to are sent as query parameters.
+	Method string `yaml:"method"`
+	// Headers are sent with the request, with environment variables such as ${API_TOKEN} expanded.
+	Headers map[string]string `yaml:"headers"`
+}
+
+// Load reads the tool definitions in the tools section of a YAML or JSON file.
+func Load(path string) ([]Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read tools %s: %w", path, err)
+	}
+	var file struct {
+		Tools []Definition `yaml:"tools"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error reading tools %s: %w", path, err)
+	}
+	for _, d := range file.Tools {
+		if err := d.Validate(); err != nil {
+			return nil, fmt.Errorf("error reading tools %s: %w", path, err)
+		}
+	}
+	return file.Tools, nil
+}
+
+// Validate checks that a definition names a tool and how to run it.
+func (d Definition) Validate() error {
+	if d.Name == "" {
+		return fmt.Errorf("a tool is missing its name")
+	}
+	if (len(d.Command) == 0) == (d.HTTP == nil) {
+		return fmt.Errorf("tool %s needs either a command or an http endpoint", d.Name)
+	}
+	if d.HTTP != nil && d.HTTP.URL == "" {
+		return fmt.Errorf("tool %s is missing its http url", d.Name)
+	}
+	return nil
+}
+
+// Declaration returns the tool as declared to the model.
+func (d Definition) Declaration() model.Tool {
+	return model.Tool{Name: d.Name, Description: d.Description, Parameters: d.Parameters}
+}
+
+// Run runs the tool's command or HTTP request with the call's arguments.
+func (d Definition) Run(ctx context.Context, args map[string]interface{}) (string, error) {
+	timeout := d.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	run := d.run
+	if d.HTTP != nil {
+		run = d.request
+	}
+	output, err := run(ctx, args)
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("tool %s timed out after %s", d.Name, timeout)
+	}
+	return output, err
+}
+
+// run runs the tool's command, returning its stdout.
+func (d Definition) run(ctx context.Context, args map[string]interface{}) (string, error) {
+	argv := make([]string, 0, len(d.Command))
+	for _, arg := range d.Command {
+		expanded, err := expand(arg, args)
+		if err != nil {
+			return "", err
+		}
+		argv = append(argv, expanded)
+	}
+	input, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, truncate(msg))
+		}
+		return "", err
+	}
+	return truncate(stdout.String()), nil
+}
+
+// request sends the tool's HTTP request, returning the response body.
+func (d Definition) request(ctx context.Context, args map[string]interface{}) (string, error) {
+	endpoint, err := expand(d.HTTP.URL, args)
+	if err != nil {
+		return "", err
+	}
+	method := strings.ToUpper(d.HTTP.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	var body io.Reader
+	if method == http.MethodGet {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return "", err
+		}
+		// arguments already in the URL, such as {{urlquery .city}}, aren't sent twice
+		referenced, err := templateArgs(d.HTTP.URL)
+		if err != nil {
+			return "", err
+		}
+		query := u.Query()
+		for k, v := range args {
+			if !referenced[k] && !referenced["."] {
+				query.Set(k, fmt.Sprint(v))
+			}
+		}
+		u.RawQuery = query.Encode()
+		endpoint = u.String()
+	} else {
+		data, err := json.Marshal(args)
+		if err != nil {
+			return "", err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return "", err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range d.HTTP.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxOutput+1))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("%s: %s", resp.Status, truncate(string(data)))
+	}
+	return truncate(string(data)), nil
+}
+
+// expand executes a template of the call's arguments; a missing argument is an error.
+func expand(text string, args map[string]interface{}) (string, error) {
+	t, err := template.New("arg").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, args); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// templateArgs returns the names of the arguments a template refers to, as .name,
+// and "." when it refers to the arguments as a whole.
+func templateArgs(text string) (map[string]bool, error) {
+	t, err := template.New("arg").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	referenced := map[string]bool{}
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n != nil {
+				for _, child := range n.Nodes {
+					walk(child)
+				}
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n != nil {
+				for _, cmd := range n.Cmds {
+					walk(cmd)
+				}
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			referenced[n.Ident[0]] = true
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.DotNode:
+			referenced["."] = true
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		}
+	}
+	walk(t.Tree.Root)
+	return referenced, nil
+}
+
+// truncate shortens output longer than maxOutput, so a chatty tool doesn't fill the context window.
+func truncate(output string) string {
+	if len(output) <= maxOutput {
+		return output
+	}
+	return output[:maxOutput] + "\n[output truncated]"
+}
@@ -0,0 +1,66 @@
+package tools
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequest(t *testing.T) {
+	// the server answers with the request's method, path, query and body
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, r.Method+" "+r.URL.EscapedPath()+"?"+r.URL.RawQuery+" "+string(body))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		url    string
+		method string
+		args   map[string]interface{}
+		want   string
+	}{
+		{
+			name:   "get with arguments in the url",
+			url:    server.URL + "/{{urlquery .city}}?format=j1",
+			method: "GET",
+			args:   map[string]interface{}{"city": "San Francisco"},
+			want:   "GET /San+Francisco?format=j1 ",
+		},
+		{
+			name:   "get with arguments as query parameters",
+			url:    server.URL + "/search",
+			method: "GET",
+			args:   map[string]interface{}{"q": "rivers", "limit": 3},
+			want:   "GET /search?limit=3&q=rivers ",
+		},
+		{
+			name:   "get with some arguments in the url",
+			url:    server.URL + "/{{if .city}}{{urlquery .city}}{{end}}",
+			method: "GET",
+			args:   map[string]interface{}{"city": "Paris", "units": "metric"},
+			want:   "GET /Paris?units=metric ",
+		},
+		{
+			name: "post",
+			url:  server.URL + "/{{.id}}",
+			args: map[string]interface{}{"id": "a", "text": "hi"},
+			want: `POST /a? {"id":"a","text":"hi"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Definition{Name: "test", HTTP: &Endpoint{URL: tt.url, Method: tt.method}}
+			got, err := d.Run(context.Background(), tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("request = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}